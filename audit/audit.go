@@ -0,0 +1,107 @@
+/*
+package audit 記錄「誰在什麼時候改了什麼」，事件會以非同步的方式經由 storage/rabbitmq 送出，
+broker 無法使用時先寫入本機的 spool 檔案，恢復後再補送。
+
+example:
+
+	audit.Init(audit.Config{
+		Publisher: storage.GetRabbitMQ(storage.RMQConfig{Path: "/storage/rabbitmq", Exchange: "audit", ExchangeType: "fanout"}),
+		SpoolDir:  "/var/spool/order/audit",
+	})
+	defer audit.Close(5 * time.Second)
+
+	err = audit.Record(ctx, "update", "order:"+id, before, after)
+*/
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/syserrno"
+	"github.com/win30221/core/utils"
+)
+
+// 操作者的類型
+const (
+	ActorUser    = "user"
+	ActorService = "service"
+	ActorSystem  = "system"
+)
+
+// Actor 執行操作的對象
+type Actor struct {
+	// Type 為 ActorUser（通過 middleware.JWT）、ActorService（通過 middleware.VerifySignature）或 ActorSystem（rmq、cron-job 等）
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	IP   string `json:"ip,omitempty"`
+}
+
+// Change 單一欄位的變更，巢狀的欄位以 "." 連接，如 "address.city"
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Event 稽核事件
+type Event struct {
+	ID       string `json:"id"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Actor    Actor  `json:"actor"`
+	// Service 記錄事件的服務
+	Service   string    `json:"service"`
+	TraceCode string    `json:"traceCode"`
+	Time      time.Time `json:"time"`
+	Changes   []Change  `json:"changes"`
+}
+
+// Record 記錄 resource 被執行 action 前後的差異，before 為 nil 時為新增，after 為 nil 時為刪除。
+// before、after 可以是 struct 或 map，會以 JSON 的欄位名稱比較，敏感的欄位（參考 SensitiveFields）只記錄有變更。
+// 事件會非同步送出，只有在無法產生差異或無法保存時回傳錯誤
+func Record(ctx *ctx.Context, action, resource string, before, after any) (err error) {
+	changes, err := Diff(before, after)
+	if err != nil {
+		err = catch.Wrap(err, syserrno.Audit, "record audit event error", fmt.Sprintf("diff audit event error. err: %s, resource: %s", err.Error(), resource))
+		return
+	}
+
+	e := Event{
+		ID:        utils.GenerateRequestId(),
+		Action:    action,
+		Resource:  resource,
+		Actor:     actorFrom(ctx),
+		Service:   basic.ServerName,
+		TraceCode: ctx.TraceCode,
+		Time:      time.Now().In(basic.TimeZone),
+		Changes:   changes,
+	}
+
+	err = defaultPublisher().enqueue(e)
+	if err != nil {
+		err = catch.Wrap(err, syserrno.Audit, "record audit event error", fmt.Sprintf("enqueue audit event error. err: %s, event: %+v", err.Error(), e))
+		return
+	}
+
+	return
+}
+
+// actorFrom 依序使用 JWT 的使用者、簽章驗證的呼叫端服務，都沒有時為服務本身
+func actorFrom(ctx *ctx.Context) (a Actor) {
+	a.IP = ctx.ClientIP
+
+	switch {
+	case ctx.UserID() != "":
+		a.Type, a.ID = ActorUser, ctx.UserID()
+	case ctx.Caller != "":
+		a.Type, a.ID = ActorService, ctx.Caller
+	default:
+		a.Type, a.ID = ActorSystem, basic.ServerName
+	}
+
+	return
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const redacted = "[REDACTED]"
+
+// SensitiveFields 名稱包含這些字（不分大小寫，忽略 _ 及 -）的欄位只記錄有變更，不記錄內容
+var SensitiveFields = []string{"password", "passwd", "secret", "token", "apikey", "cardnumber", "cvv"}
+
+// Diff 以 JSON 的欄位比較 before 及 after，回傳依欄位名稱排序的變更，陣列視為單一欄位
+func Diff(before, after any) (changes []Change, err error) {
+	b, err := flatten(before)
+	if err != nil {
+		err = fmt.Errorf("flatten before error: %s", err.Error())
+		return
+	}
+
+	a, err := flatten(after)
+	if err != nil {
+		err = fmt.Errorf("flatten after error: %s", err.Error())
+		return
+	}
+
+	changes = []Change{}
+	fields := map[string]bool{}
+	for k := range b {
+		fields[k] = true
+	}
+	for k := range a {
+		fields[k] = true
+	}
+
+	for field := range fields {
+		bv, av := b[field], a[field]
+		if reflect.DeepEqual(bv, av) {
+			continue
+		}
+
+		if sensitive(field) {
+			bv, av = mask(bv), mask(av)
+		}
+		changes = append(changes, Change{Field: field, Before: bv, After: av})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return
+}
+
+// flatten 將資料轉為 JSON 後展開為 "a.b.c" 的欄位
+func flatten(v any) (res map[string]any, err error) {
+	res = map[string]any{}
+	if v == nil {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	var decoded any
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return
+	}
+
+	m, ok := decoded.(map[string]any)
+	if !ok {
+		// 不是 object 時整個值視為一個欄位
+		res[""] = decoded
+		return
+	}
+
+	flattenInto(res, "", m)
+	return
+}
+
+func flattenInto(res map[string]any, prefix string, m map[string]any) {
+	for k, v := range m {
+		field := k
+		if prefix != "" {
+			field = prefix + "." + k
+		}
+
+		if child, ok := v.(map[string]any); ok && len(child) > 0 {
+			flattenInto(res, field, child)
+			continue
+		}
+		res[field] = v
+	}
+}
+
+func sensitive(field string) bool {
+	field = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(field))
+	for _, s := range SensitiveFields {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(v any) any {
+	if v == nil {
+		return nil
+	}
+	return redacted
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type user struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Tags     []string `json:"tags"`
+	Address  address  `json:"address"`
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   []Change
+	}{
+		{
+			name:   "no change",
+			before: user{Name: "a", Tags: []string{"x"}},
+			after:  user{Name: "a", Tags: []string{"x"}},
+			want:   []Change{},
+		},
+		{
+			name:   "nested field",
+			before: user{Name: "a", Address: address{City: "Taipei"}},
+			after:  user{Name: "a", Address: address{City: "Tainan", Zip: "700"}},
+			want: []Change{
+				{Field: "address.city", Before: "Taipei", After: "Tainan"},
+				{Field: "address.zip", Before: nil, After: "700"},
+			},
+		},
+		{
+			name:   "array as a single field",
+			before: user{Tags: []string{"x"}},
+			after:  user{Tags: []string{"x", "y"}},
+			want: []Change{
+				{Field: "tags", Before: []any{"x"}, After: []any{"x", "y"}},
+			},
+		},
+		{
+			name:   "sensitive field",
+			before: map[string]any{"password": "old", "api_key": nil},
+			after:  map[string]any{"password": "new", "api_key": "k"},
+			want: []Change{
+				{Field: "api_key", Before: nil, After: redacted},
+				{Field: "password", Before: redacted, After: redacted},
+			},
+		},
+		{
+			name:   "create",
+			before: nil,
+			after:  map[string]any{"name": "a"},
+			want: []Change{
+				{Field: "name", Before: nil, After: "a"},
+			},
+		},
+		{
+			name:   "delete",
+			before: map[string]any{"name": "a"},
+			after:  nil,
+			want: []Change{
+				{Field: "name", Before: "a", After: nil},
+			},
+		},
+		{
+			name:   "not an object",
+			before: 1,
+			after:  2,
+			want: []Change{
+				{Field: "", Before: float64(1), After: float64(2)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_error(t *testing.T) {
+	if _, err := Diff(make(chan int), nil); err == nil {
+		t.Error("Diff() error = nil, want error")
+	}
+}
@@ -0,0 +1,320 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/win30221/core/storage/rabbitmq"
+	"go.uber.org/zap"
+)
+
+// Publisher 送出事件的對象，需要在 broker 確認收到後才回傳 nil，*rabbitmq.Connection 符合此介面
+type Publisher interface {
+	PublishConfirm(m rabbitmq.Message, timeout time.Duration) error
+}
+
+type Config struct {
+	Publisher Publisher
+	// Queue 送出時的 routing key（rabbitmq.Message.Queue），使用 fanout exchange 時可以為空值
+	Queue string
+	// SpoolDir broker 無法使用時暫存事件的目錄，空值時無法送出的事件只會記錄在 log
+	SpoolDir string
+	// BufferSize 等待送出的事件數量上限，超過時直接寫入 spool，預設為 1024
+	BufferSize int
+	// RetryInterval 補送 spool 的間隔，預設為 30 秒
+	RetryInterval time.Duration
+	// ConfirmTimeout 等待 broker 確認的時間，預設為 5 秒
+	ConfirmTimeout time.Duration
+	// MaxSpoolSize spool 檔案的大小上限（bytes），超過時事件只會記錄在 log，預設為 100 MB
+	MaxSpoolSize int64
+}
+
+const spoolFile = "audit.spool"
+
+var (
+	mu  sync.RWMutex
+	std *publisher
+)
+
+// Init 開始在背景送出事件，需要在 Record 之前呼叫，服務結束前呼叫 Close
+func Init(conf Config) (err error) {
+	if conf.Publisher == nil {
+		return errors.New("audit publisher is nil")
+	}
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = 1024
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = 30 * time.Second
+	}
+	if conf.ConfirmTimeout <= 0 {
+		conf.ConfirmTimeout = 5 * time.Second
+	}
+	if conf.MaxSpoolSize <= 0 {
+		conf.MaxSpoolSize = 100 << 20
+	}
+
+	p := &publisher{
+		conf:   conf,
+		events: make(chan Event, conf.BufferSize),
+		done:   make(chan struct{}),
+	}
+
+	if conf.SpoolDir != "" {
+		if err = os.MkdirAll(conf.SpoolDir, 0o755); err != nil {
+			err = fmt.Errorf("create audit spool dir error: %s", err.Error())
+			return
+		}
+		// 上次結束前還沒補送的事件
+		if info, err := os.Stat(p.spoolPath()); err == nil && info.Size() > 0 {
+			p.pending.Store(true)
+		}
+	}
+
+	go p.run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	std = p
+
+	return
+}
+
+// Close 停止接收事件，並在 timeout 內送出或寫入 spool 剩餘的事件，最後再補送一次 spool
+func Close(timeout time.Duration) {
+	mu.Lock()
+	p := std
+	std = nil
+	mu.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	p.closeOnce.Do(func() {
+		p.state.Lock()
+		p.closed = true
+		close(p.events)
+		p.state.Unlock()
+	})
+
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		zap.L().Warn("audit: close timeout, some events may be lost")
+	}
+}
+
+func defaultPublisher() *publisher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return std
+}
+
+type publisher struct {
+	conf   Config
+	events chan Event
+	done   chan struct{}
+
+	state     sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+
+	// spoolMu 保護 spool 檔案，pending 表示 spool 中還有事件未補送
+	spoolMu sync.Mutex
+	pending atomic.Bool
+}
+
+func (p *publisher) enqueue(e Event) error {
+	if p == nil {
+		return errors.New("audit is not initialized")
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+
+	if p.closed {
+		return p.spool(e)
+	}
+
+	select {
+	case p.events <- e:
+		return nil
+	default:
+		// 等待送出的事件已滿時不阻塞請求
+		return p.spool(e)
+	}
+}
+
+func (p *publisher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.conf.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-p.events:
+			if !ok {
+				// 結束前最後一次補送，失敗的部分留到下次啟動
+				p.replay()
+				return
+			}
+			p.publishOrSpool(e)
+		case <-ticker.C:
+			p.replay()
+		}
+	}
+}
+
+func (p *publisher) publishOrSpool(e Event) {
+	// spool 中還有事件時先寫入 spool，維持事件的順序
+	if !p.pending.Load() {
+		err := p.publish(e)
+		if err == nil {
+			return
+		}
+		zap.L().Warn("audit: publish event error: "+err.Error(), zap.String("id", e.ID))
+	}
+
+	if err := p.spool(e); err != nil {
+		zap.L().Error("audit: "+err.Error(), zap.Any("event", e))
+	}
+}
+
+func (p *publisher) publish(e Event) (err error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	return p.publishRaw(e, data)
+}
+
+func (p *publisher) publishRaw(e Event, data []byte) error {
+	return p.conf.Publisher.PublishConfirm(rabbitmq.Message{
+		Queue:         p.conf.Queue,
+		ContentType:   "application/json",
+		CorrelationId: e.ID,
+		TraceCode:     e.TraceCode,
+		Body: rabbitmq.MessageBody{
+			Data: data,
+			Type: "audit",
+		},
+	}, p.conf.ConfirmTimeout)
+}
+
+func (p *publisher) spoolPath() string {
+	return filepath.Join(p.conf.SpoolDir, spoolFile)
+}
+
+// spool 以 JSON lines 的格式寫入 spool 檔案，超過 MaxSpoolSize 時回傳錯誤
+func (p *publisher) spool(e Event) (err error) {
+	if p.conf.SpoolDir == "" {
+		return errors.New("spool dir is not set")
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		err = fmt.Errorf("marshal audit event error: %s", err.Error())
+		return
+	}
+
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	f, err := os.OpenFile(p.spoolPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		err = fmt.Errorf("open audit spool error: %s", err.Error())
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		err = fmt.Errorf("stat audit spool error: %s", err.Error())
+		return
+	}
+	if info.Size()+int64(len(data))+1 > p.conf.MaxSpoolSize {
+		err = fmt.Errorf("audit spool is full: %d bytes", info.Size())
+		return
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		err = fmt.Errorf("write audit spool error: %s", err.Error())
+		return
+	}
+	p.pending.Store(true)
+
+	return
+}
+
+// replay 依序補送 spool 中的事件，失敗時保留還沒送出的部分等下次補送
+func (p *publisher) replay() {
+	if !p.pending.Load() {
+		return
+	}
+
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	data, err := os.ReadFile(p.spoolPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			p.pending.Store(false)
+			return
+		}
+		zap.L().Warn("audit: read spool error: " + err.Error())
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+
+	sent := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			sent++
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			zap.L().Error("audit: drop invalid spool line: "+err.Error(), zap.ByteString("line", line))
+			sent += len(line) + 1
+			continue
+		}
+
+		if err := p.publishRaw(e, line); err != nil {
+			zap.L().Warn("audit: replay spool error: " + err.Error())
+			p.rewriteSpool(data[sent:])
+			return
+		}
+		sent += len(line) + 1
+	}
+
+	if err := os.Remove(p.spoolPath()); err != nil {
+		zap.L().Warn("audit: remove spool error: " + err.Error())
+		return
+	}
+	p.pending.Store(false)
+}
+
+// rewriteSpool 以暫存檔取代 spool，避免寫到一半時遺失事件
+func (p *publisher) rewriteSpool(remain []byte) {
+	tmp := p.spoolPath() + ".tmp"
+	if err := os.WriteFile(tmp, remain, 0o644); err != nil {
+		zap.L().Warn("audit: rewrite spool error: " + err.Error())
+		return
+	}
+	if err := os.Rename(tmp, p.spoolPath()); err != nil {
+		zap.L().Warn("audit: rewrite spool error: " + err.Error())
+	}
+}
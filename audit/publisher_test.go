@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/win30221/core/storage/rabbitmq"
+)
+
+// fakePublisher 記錄送出的事件 id，fail 為 true 或已送出 limit 筆時模擬 broker 無法使用
+type fakePublisher struct {
+	mu    sync.Mutex
+	fail  bool
+	limit int
+	ids   []string
+}
+
+func (f *fakePublisher) PublishConfirm(m rabbitmq.Message, timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail || (f.limit > 0 && len(f.ids) >= f.limit) {
+		return errors.New("broker unavailable")
+	}
+	f.ids = append(f.ids, m.CorrelationId)
+	return nil
+}
+
+func (f *fakePublisher) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakePublisher) sent() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.ids, ",")
+}
+
+func newTestPublisher(t *testing.T, f *fakePublisher) *publisher {
+	return &publisher{
+		conf: Config{
+			Publisher:      f,
+			SpoolDir:       t.TempDir(),
+			ConfirmTimeout: time.Second,
+			MaxSpoolSize:   1 << 20,
+		},
+	}
+}
+
+func TestPublisher_replayOrder(t *testing.T) {
+	f := &fakePublisher{fail: true}
+	p := newTestPublisher(t, f)
+
+	p.publishOrSpool(Event{ID: "1"})
+	p.publishOrSpool(Event{ID: "2"})
+
+	// broker 恢復後，spool 還沒補送前的事件也要寫入 spool，維持順序
+	f.setFail(false)
+	p.publishOrSpool(Event{ID: "3"})
+	if got := f.sent(); got != "" {
+		t.Fatalf("sent before replay = %q, want empty", got)
+	}
+
+	p.replay()
+	if got := f.sent(); got != "1,2,3" {
+		t.Errorf("sent = %q, want %q", got, "1,2,3")
+	}
+	if p.pending.Load() {
+		t.Error("pending = true after replay")
+	}
+	if _, err := os.Stat(p.spoolPath()); !os.IsNotExist(err) {
+		t.Errorf("spool still exists: %v", err)
+	}
+
+	p.publishOrSpool(Event{ID: "4"})
+	if got := f.sent(); got != "1,2,3,4" {
+		t.Errorf("sent = %q, want %q", got, "1,2,3,4")
+	}
+}
+
+func TestPublisher_replayPartial(t *testing.T) {
+	f := &fakePublisher{fail: true}
+	p := newTestPublisher(t, f)
+	for _, id := range []string{"1", "2", "3"} {
+		p.publishOrSpool(Event{ID: id})
+	}
+
+	// 只送出第一筆，剩下的保留在 spool
+	f.setFail(false)
+	f.limit = 1
+	p.replay()
+	if got := f.sent(); got != "1" {
+		t.Fatalf("sent = %q, want %q", got, "1")
+	}
+	if !p.pending.Load() {
+		t.Fatal("pending = false, want true")
+	}
+
+	f.limit = 0
+	p.replay()
+	if got := f.sent(); got != "1,2,3" {
+		t.Errorf("sent = %q, want %q", got, "1,2,3")
+	}
+}
+
+func TestPublisher_spoolFull(t *testing.T) {
+	f := &fakePublisher{fail: true}
+	p := newTestPublisher(t, f)
+	p.conf.MaxSpoolSize = 200
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = p.spool(Event{ID: "id", Action: "update"})
+	}
+	if err == nil || !strings.Contains(err.Error(), "full") {
+		t.Fatalf("spool() error = %v, want spool is full", err)
+	}
+
+	info, statErr := os.Stat(p.spoolPath())
+	if statErr != nil {
+		t.Fatal(statErr)
+	}
+	if info.Size() > p.conf.MaxSpoolSize {
+		t.Errorf("spool size = %d, want <= %d", info.Size(), p.conf.MaxSpoolSize)
+	}
+}
+
+func TestClose_replay(t *testing.T) {
+	f := &fakePublisher{fail: true}
+	dir := t.TempDir()
+	if err := Init(Config{Publisher: f, SpoolDir: dir, RetryInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := defaultPublisher()
+	for _, id := range []string{"1", "2"} {
+		if err := p.enqueue(Event{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 等背景寫入 spool
+	deadline := time.Now().Add(time.Second)
+	for !p.pending.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	f.setFail(false)
+	Close(time.Second)
+
+	if got := f.sent(); got != "1,2" {
+		t.Errorf("sent = %q, want %q", got, "1,2")
+	}
+}
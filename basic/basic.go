@@ -16,6 +16,8 @@ func Init(serverName string) {
 	// Load consul env
 	// 載入內部系統 Private Token。這個參數在 http middleware 的 valid_token 會使用到
 	SysToken, _ = config.GetString("/system/systoken", true)
+	// 輪替 SysToken 期間被呼叫端額外接受的 token，通常沒有設定
+	SysTokens, _ = config.GetStringSlice("/system/systokens", false)
 	Site, _ = config.GetString("/system/site", true)
 	LogMode, _ = config.GetString(fmt.Sprintf("/service/%s/log_mode", ServerName), false)
 	if LogMode == "" {
@@ -10,6 +10,7 @@ var (
 	Port       string
 	Host       string
 	SysToken   string
+	SysTokens  []string
 	ConsulIP   string
 	Debug      bool
 	Version    string
@@ -0,0 +1,10 @@
+// errcatalog 匯出 core 內建的錯誤代碼，service 的錯誤代碼請參考 syserrno/catalog 的說明建立自己的指令
+//
+//	go run github.com/win30221/core/cmd/errcatalog -f openapi -i ./i18n/messages.toml -o errors.json
+package main
+
+import "github.com/win30221/core/syserrno/catalog"
+
+func main() {
+	catalog.Main()
+}
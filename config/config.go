@@ -18,6 +18,8 @@ import (
 var (
 	ip                 = "127.0.0.1"
 	ErrOnTypeIncorrect = errors.New("type incorrect")
+	// ErrNotFound consul 中沒有該路徑或 key，existOnErr 為 false 時視為選填的設定，不會記錄 log
+	ErrNotFound = errors.New("Not Found")
 )
 
 func Ping() (err error) {
@@ -60,7 +62,9 @@ func Get(key string, existOnErr bool, convert func(any) error) (err error) {
 				log.Fatalf("Error on load `%+v` from consul, Err: %v", key, err.Error())
 			}
 
-			log.Printf("Error on load `%+v` from consul, Err: %v", key, err.Error())
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Error on load `%+v` from consul, Err: %v", key, err.Error())
+			}
 		}
 	}()
 
@@ -84,13 +88,13 @@ func Get(key string, existOnErr bool, convert func(any) error) (err error) {
 	vObj.SetConfigType("toml")
 	err = vObj.ReadRemoteConfig()
 	if err != nil {
-		err = fmt.Errorf("%v (no section: %v)", err, key)
+		err = remoteError(err, key)
 		return
 	}
 
 	res := vObj.Get(k)
 	if res == nil {
-		err = errors.New("Key `" + key + "` Not Found")
+		err = fmt.Errorf("Key `%s` %w", key, ErrNotFound)
 		return
 	}
 
@@ -102,6 +106,15 @@ func Get(key string, existOnErr bool, convert func(any) error) (err error) {
 	return
 }
 
+// remoteError 讀取 consul 的錯誤，路徑不存在時 viper 回傳 "No Files Found"，包裝為 ErrNotFound
+func remoteError(err error, key string) error {
+	var rce viper.RemoteConfigError
+	if errors.As(err, &rce) && rce == "No Files Found" {
+		return fmt.Errorf("%v (no section: %v): %w", err, key, ErrNotFound)
+	}
+	return fmt.Errorf("%v (no section: %v)", err, key)
+}
+
 // GetString
 // 假設 consul 路徑 "/storage/redis" 內有下列資料
 // `
@@ -359,7 +372,9 @@ func GetFileStringMap(path string, existOnErr bool) (result map[string]string, e
 				os.Exit(1)
 			}
 
-			log.Printf("Error on load `%+v` from consul, Err: %v", path, err.Error())
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Error on load `%+v` from consul, Err: %v", path, err.Error())
+			}
 		}
 	}()
 
@@ -370,7 +385,7 @@ func GetFileStringMap(path string, existOnErr bool) (result map[string]string, e
 
 	err = vObj.ReadRemoteConfig()
 	if err != nil {
-		err = fmt.Errorf("%v (no section: %v)", err, path)
+		err = remoteError(err, path)
 		return
 	}
 
@@ -385,3 +400,117 @@ func GetFileStringMap(path string, existOnErr bool) (result map[string]string, e
 
 	return
 }
+
+// Values 從 consul 一次讀取的整份設定，key 為以 "." 連接的小寫路徑，如 "retry.max_retries"
+type Values map[string]any
+
+// GetValues 讀取 consul 路徑下的整份設定，用在一次載入多個欄位的 policy，取代 GetFileStringMap。
+// 假設 consul 路徑 "/system/cors" 內有下列資料
+// `
+//
+//	allow_origins = ["https://app.example.com", "re:^https://a{1,3}\\.example\\.com$"]
+//	max_age = "10m"
+//	[dev]
+//	allow_credentials = true
+//
+// `
+//
+// 使用 GetValues("/system/cors")
+// return: Values{"allow_origins": []any{...}, "max_age": "10m", "dev.allow_credentials": true}
+func GetValues(path string, existOnErr bool) (result Values, err error) {
+	defer func() {
+		if err != nil {
+			if existOnErr {
+				log.Fatalf("Error on load `%+v` from consul, Err: %v", path, err.Error())
+			}
+
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Error on load `%+v` from consul, Err: %v", path, err.Error())
+			}
+		}
+	}()
+
+	vObj := viper.New()
+
+	vObj.AddRemoteProvider("consul", ip+":8500", path)
+	vObj.SetConfigType("toml")
+
+	err = vObj.ReadRemoteConfig()
+	if err != nil {
+		err = remoteError(err, path)
+		return
+	}
+
+	result = Values{}
+	for _, key := range vObj.AllKeys() {
+		result[key] = vObj.Get(key)
+	}
+
+	return
+}
+
+// Has key 是否有設定
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+func (v Values) String(key string) string {
+	return cast.ToString(v[key])
+}
+
+func (v Values) Int(key string) int {
+	return cast.ToInt(v[key])
+}
+
+func (v Values) Bool(key string) bool {
+	return cast.ToBool(v[key])
+}
+
+// Duration 以 time.ParseDuration 解析，沒有設定或格式錯誤時 ok 為 false
+func (v Values) Duration(key string) (d time.Duration, ok bool) {
+	d, err := time.ParseDuration(v.String(key))
+	return d, err == nil
+}
+
+// Strings TOML 陣列直接使用，字串則以逗號分隔（去除空白及空值）。
+// 值本身可能包含逗號時（如正規表示式）請使用陣列
+func (v Values) Strings(key string) (res []string) {
+	switch t := v[key].(type) {
+	case nil:
+		return
+	case []any, []string:
+		return cast.ToStringSlice(t)
+	default:
+		for _, s := range strings.Split(cast.ToString(t), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				res = append(res, s)
+			}
+		}
+		return
+	}
+}
+
+// Section 取得 prefix 區塊下的設定，回傳的 key 不包含 prefix，如 Section("retry") 的 "max_retries"
+func (v Values) Section(prefix string) (res Values) {
+	res = Values{}
+	prefix = strings.ToLower(prefix) + "."
+	for k, val := range v {
+		if name, found := strings.CutPrefix(k, prefix); found {
+			res[name] = val
+		}
+	}
+	return
+}
+
+// Override 回傳以 section 區塊覆寫最上層設定的結果，用在依照 basic.Site 覆寫設定
+func (v Values) Override(section string) (res Values) {
+	res = Values{}
+	for k, val := range v {
+		res[k] = val
+	}
+	for k, val := range v.Section(section) {
+		res[k] = val
+	}
+	return
+}
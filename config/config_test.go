@@ -0,0 +1,29 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func Test_remoteError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantNotFound bool
+	}{
+		{name: "missing path", err: viper.RemoteConfigError("No Files Found"), wantNotFound: true},
+		{name: "no providers", err: viper.RemoteConfigError("No Remote Providers")},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := remoteError(tt.err, "/system/systokens")
+			if got := errors.Is(err, ErrNotFound); got != tt.wantNotFound {
+				t.Errorf("errors.Is(%v, ErrNotFound) = %v, want %v", err, got, tt.wantNotFound)
+			}
+		})
+	}
+}
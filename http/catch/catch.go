@@ -1,18 +1,34 @@
 package catch
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
+
+	"github.com/win30221/core/syserrno"
 )
 
-type customError struct {
+// Error 為 core 統一使用的錯誤型別，可透過 errors.As 取出
+type Error struct {
 	Code      string
 	OutputMsg string
 	LogMsg    string
 	Stack     string
+
+	// detail 以指標保存是為了讓 Error 仍然可以用 `==` 比較
+	// （如 err == mongodb.ErrNoDocuments），不會因為原始錯誤的型別不可比較而 panic
+	detail *detail
+}
+
+type detail struct {
+	// cause 為被包裝的原始錯誤
+	cause error
+	// params 為翻譯訊息時的插值參數
+	params map[string]any
 }
 
 func getCallStack(min, max int) string {
@@ -36,14 +52,20 @@ func getCallStack(min, max int) string {
 	return strings.Join(callers, " ")
 }
 
-// NewWitStack 用在自定義套件（如 core/storage/redis/redis.go）中的 error
-func NewWitStack(code, outputMsg, logMsg string, startStack int) error {
-	if startStack-1 < 0 {
-		return customError{
+// newError 建立 Error，startStack 需要包含 newError 本身這一層
+func newError(err error, code, outputMsg, logMsg string, startStack int) Error {
+	var d *detail
+	if err != nil {
+		d = &detail{cause: err}
+	}
+
+	if startStack-2 < 0 {
+		return Error{
 			Code:      code,
 			OutputMsg: outputMsg,
 			LogMsg:    fmt.Sprintf("[warning]: start stack must greater than 0, %s", logMsg),
 			Stack:     getCallStack(0, 10),
+			detail:    d,
 		}
 	}
 
@@ -56,44 +78,96 @@ func NewWitStack(code, outputMsg, logMsg string, startStack int) error {
 		fName = match[1]
 	}
 
-	return customError{
+	return Error{
 		Code:      code,
 		OutputMsg: outputMsg,
 		LogMsg:    fmt.Sprintf("`%s`, %s", fName, logMsg),
 		Stack:     getCallStack(startStack, startStack+4),
+		detail:    d,
 	}
 }
 
+// NewWitStack 用在自定義套件（如 core/storage/redis/redis.go）中的 error
+func NewWitStack(code, outputMsg, logMsg string, startStack int) error {
+	return newError(nil, code, outputMsg, logMsg, startStack+1)
+}
+
 // New 用在 http server 目前架構的層級中
 func New(code, outputMsg, logMsg string) error {
-	return NewWitStack(code, outputMsg, logMsg, 3)
+	return newError(nil, code, outputMsg, logMsg, 3)
 }
 
-func (e customError) Error() string {
+// WrapWitStack 與 NewWitStack 相同，但會保留原始錯誤，之後可用 errors.Is/errors.As 判斷
+func WrapWitStack(err error, code, outputMsg, logMsg string, startStack int) error {
+	return newError(err, code, outputMsg, logMsg, startStack+1)
+}
+
+// Wrap 與 New 相同，但會保留原始錯誤，之後可用 errors.Is/errors.As 判斷
+//
+// example:
+//
+//	err = catch.Wrap(err, syserrno.MySQL, "get user error", fmt.Sprintf("scan user error. err: %s", err.Error()))
+//	errors.Is(err, sql.ErrNoRows) // true
+func Wrap(err error, code, outputMsg, logMsg string) error {
+	return newError(err, code, outputMsg, logMsg, 3)
+}
+
+func (e Error) Error() string {
 	return fmt.Sprintf("Code: %s, OutputMsg: %s, LogMsg: %s, stack: %s", e.Code, e.OutputMsg, e.LogMsg, e.Stack)
 }
 
+// Unwrap 回傳被包裝的原始錯誤
+func (e Error) Unwrap() error {
+	if e.detail == nil {
+		return nil
+	}
+	return e.detail.cause
+}
+
+// Params 回傳翻譯訊息時使用的插值參數
+func (e Error) Params() map[string]any {
+	if e.detail == nil {
+		return nil
+	}
+	return e.detail.params
+}
+
 // Info 給 http response package 用來輸出、列印訊息時使用
-func (e customError) Info() (string, string, string, string) {
+func (e Error) Info() (string, string, string, string) {
 	return e.Code, e.OutputMsg, e.LogMsg, e.Stack
 }
 
-func CheckCustomError(err error) (e customError, ok bool) {
-	e, ok = err.(customError)
+// CheckCustomError 取出錯誤鏈中第一個 Error
+func CheckCustomError(err error) (e Error, ok bool) {
+	ok = errors.As(err, &e)
 	return
 }
 
-// 抓取是否有相同的錯誤代碼
+// 抓取錯誤鏈中是否有相同的錯誤代碼
 func CheckSpecificCode(err error, code string) bool {
-	if customErr, ok := err.(customError); ok {
-		return customErr.Code == code
+	for err != nil {
+		if e, ok := err.(Error); ok && e.Code == code {
+			return true
+		}
+
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				if CheckSpecificCode(err, code) {
+					return true
+				}
+			}
+			return false
+		}
+
+		err = errors.Unwrap(err)
 	}
 	return false
 }
 
-// ReplaceOutPutMsg 用在 gateway 的 repository 錯誤出現不同錯誤碼時會需要替換回傳的錯誤訊息
+// ReplaceOutPutMsg 用在 gateway 的 repository 錯誤出現不同錯誤碼時會需要替換回傳的錯誤訊息，
+// 錯誤鏈中的其他錯誤會被保留
 func ReplaceOutPutMsg(err error, msg string) error {
-	e, ok := CheckCustomError(err)
+	e, ok := outermost(err)
 	if !ok {
 		return err
 	}
@@ -102,3 +176,59 @@ func ReplaceOutPutMsg(err error, msg string) error {
 
 	return e
 }
+
+// outermost 回傳錯誤鏈中第一個 Error 的複本：err 本身就是 Error 時直接修改，
+// 外層還有其他包裝（如 fmt.Errorf 的 %w）時改以 err 為原始錯誤，避免外層的錯誤被丟掉
+func outermost(err error) (e Error, ok bool) {
+	if e, ok = err.(Error); ok {
+		return
+	}
+
+	if e, ok = CheckCustomError(err); !ok {
+		return
+	}
+
+	d := &detail{cause: err}
+	if e.detail != nil {
+		d.params = e.detail.params
+	}
+	e.detail = d
+
+	return
+}
+
+// WithParams 設定翻譯訊息時使用的插值參數，訊息中的 `{{key}}` 會被替換為對應的值
+//
+// example:
+//
+//	err = catch.WithParams(catch.New(syserrno.ValidParameter, "amount must less than {{max}}", "amount too large"), map[string]any{"max": 100})
+func WithParams(err error, params map[string]any) error {
+	e, ok := outermost(err)
+	if !ok {
+		return err
+	}
+
+	d := &detail{params: params}
+	if e.detail != nil {
+		d.cause = e.detail.cause
+	}
+	e.detail = d
+
+	return e
+}
+
+// Panic 將 recover() 取得的內容轉為 Error，Stack 為完整的 goroutine stack
+func Panic(rec any) error {
+	var err error
+	switch v := rec.(type) {
+	case error:
+		err = v
+	default:
+		err = fmt.Errorf("%v", v)
+	}
+
+	e := newError(err, syserrno.Undefined, "internal server error", fmt.Sprintf("panic recovered: %s", err.Error()), 3)
+	e.Stack = string(debug.Stack())
+
+	return e
+}
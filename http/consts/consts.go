@@ -6,4 +6,52 @@ const (
 	HeaderSysToken      = "SysToken"
 	HeaderAuthorization = "Authorization"
 	HeaderLang          = "Lang"
+
+	HeaderAcceptLanguage = "Accept-Language"
+	HeaderRetryAfter     = "Retry-After"
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed middleware.Idempotency 重送先前保存的回應時帶上
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// HeaderXRequestTimeout 呼叫端剩餘的時間（毫秒），參考 middleware.Timeout
+	HeaderXRequestTimeout = "X-Request-Timeout"
+	// HeaderXCache middleware.Cache 回傳是否使用快取（HIT、MISS）
+	HeaderXCache = "X-Cache"
+
+	// middleware.RateLimit
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+
+	// 內部服務簽章，參考 http/sign
+	HeaderXService       = "X-Service"
+	HeaderXKeyId         = "X-Key-Id"
+	HeaderXTimestamp     = "X-Timestamp"
+	HeaderXNonce         = "X-Nonce"
+	HeaderXContentSha256 = "X-Content-Sha256"
+	HeaderXSignature     = "X-Signature"
+)
+
+// gin.Context 中由 middleware 設定、ctx.New 讀取的 key
+const (
+	// KeyCaller 通過簽章驗證的呼叫端服務名稱，以 SysToken 驗證的請求沒有此值
+	KeyCaller = "caller"
+	// KeyClaims, KeyUserID 通過 JWT 驗證的 claims 及使用者 id
+	KeyClaims = "claims"
+	KeyUserID = "userID"
+	// KeyInternal 通過 SysToken 或簽章驗證的內部服務請求
+	KeyInternal = "internal"
+	// KeyLang middleware.LangMiddleware 決定的語系
+	KeyLang = "lang"
+	// KeyBodyTooLarge 請求 body 超過 middleware.BodyLimit 的限制
+	KeyBodyTooLarge = "bodyTooLarge"
+	// KeyStore 同一個請求的 ctx.Context 共用的資料
+	KeyStore = "ctxStore"
+)
+
+// ctx.Context 中由 storage、http/request 寫入，access log 輸出的紀錄
+const (
+	// KeySQLLogs MySQL 執行的 SQL
+	KeySQLLogs = "sqlLogs"
+	// KeyHTTPLogs http/request 對外呼叫的紀錄
+	KeyHTTPLogs = "httpLogs"
 )
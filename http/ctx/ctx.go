@@ -2,33 +2,237 @@ package ctx
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/jwt/claims"
 	"github.com/win30221/core/utils"
 )
 
-// 如果是在 rmq 或 cron-job 中使用，就不會有 gin 的 context，因此直接使用 Context 的 struct 來建立 ctx
+// Context 本身實作 context.Context，可以直接傳給 MySQL、Redis 等需要 context.Context 的地方。
+// 在 gin 中使用 New 建立，rmq、cron-job 等沒有 gin 的地方使用 FromHTTP、FromMessage、FromContext 或 NewEmpty
 type Context struct {
-	// 在 response 的時候 callback
+	// 在 response 的時候 callback，不是由 New 建立時為 nil
 	GinContext *gin.Context
 	// request
 	Context   context.Context
 	TraceCode string
+	// Lang 由 middleware.LangMiddleware 決定，response 會依此回傳翻譯後的錯誤訊息
+	Lang string
+	// Caller 由 middleware.VerifySignature 驗證後的呼叫端服務名稱，未經驗證時為空值
+	Caller string
+	// ClientIP 呼叫端的 IP，沒有時為空值
+	ClientIP string
+
+	// 由 middleware.JWT 驗證後的 claims
+	claims claims.Claims
+	userID string
+
+	// 同一個請求共用的資料，如 SQL 及對外呼叫的紀錄
+	store *store
 }
 
+// contextKey 用來從衍生的 context.Context 中取回 *Context，參考 FromContext
+type contextKey struct{}
+
+// New 由 gin 建立，同一個請求中建立的 Context 共用同一份資料
 func New(c *gin.Context, ctx context.Context) *Context {
-	return &Context{
+	res := &Context{
 		GinContext: c,
 		Context:    ctx,
 		TraceCode:  c.Request.Header.Get(consts.HeaderXRequestId),
+		Lang:       c.Request.Header.Get(consts.HeaderLang),
+		Caller:     c.GetString(consts.KeyCaller),
+		ClientIP:   c.ClientIP(),
+		userID:     c.GetString(consts.KeyUserID),
+		store:      ginStore(c),
 	}
+
+	// 經過 middleware.LangMiddleware 時使用解析後的語系
+	if lang, ok := c.Get(consts.KeyLang); ok {
+		res.Lang, _ = lang.(string)
+	}
+
+	if v, ok := c.Get(consts.KeyClaims); ok {
+		res.claims, _ = v.(claims.Claims)
+	}
+
+	return res
 }
 
-func NewEmpty() *Context {
+// FromHTTP 由 net/http 的請求建立，沒有 X-Request-Id 時產生新的 traceCode
+func FromHTTP(r *http.Request) *Context {
+	res := &Context{
+		Context:   r.Context(),
+		TraceCode: r.Header.Get(consts.HeaderXRequestId),
+		Lang:      r.Header.Get(consts.HeaderLang),
+		store:     newStore(),
+	}
+
+	if res.TraceCode == "" {
+		res.TraceCode = utils.GenerateRequestId()
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		res.ClientIP = host
+	}
+
+	return res
+}
+
+// FromMessage 由 message queue 的訊息建立，headers 有 X-Request-Id 時沿用呼叫端的 traceCode，
+// parent 通常使用 rabbitmq.DeliveryContext 帶上訊息的處理期限
+//
+// example:
+//
+//	for d := range deliveries {
+//		c, cancel := rabbitmq.DeliveryContext(d)
+//		err := handle(ctx.FromMessage(c, d.Headers), d)
+//		cancel()
+//	}
+func FromMessage(parent context.Context, headers map[string]any) *Context {
+	res := &Context{
+		Context: parent,
+		store:   newStore(),
+	}
+
+	res.TraceCode, _ = headers[consts.HeaderXRequestId].(string)
+	if res.TraceCode == "" {
+		res.TraceCode = utils.GenerateRequestId()
+	}
+
+	return res
+}
+
+// FromContext 由一般的 context.Context 建立，parent 由 *Context 衍生時（如 context.WithTimeout(ctx, d)）
+// 沿用原本的 traceCode、身分及資料
+func FromContext(parent context.Context) *Context {
+	if c, ok := parent.(*Context); ok {
+		return c
+	}
+
+	if c, ok := parent.Value(contextKey{}).(*Context); ok {
+		return c.WithContext(parent)
+	}
+
 	return &Context{
-		GinContext: &gin.Context{},
-		Context:    context.Background(),
-		TraceCode:  utils.GenerateRequestId(),
+		Context:   parent,
+		TraceCode: utils.GenerateRequestId(),
+		store:     newStore(),
+	}
+}
+
+func NewEmpty() *Context {
+	return FromContext(context.Background())
+}
+
+// WithContext 回傳使用 parent 的複本，traceCode、身分及資料與原本的 Context 共用
+func (c *Context) WithContext(parent context.Context) *Context {
+	res := *c
+	res.Context = parent
+	res.store = c.values()
+	return &res
+}
+
+// UserID 通過 JWT 驗證的使用者 id，沒有經過 middleware.JWT 時為空值
+func (c *Context) UserID() string {
+	return c.userID
+}
+
+// Claims 通過 JWT 驗證的 claims，沒有經過 middleware.JWT 時為 nil
+func (c *Context) Claims() claims.Claims {
+	return c.claims
+}
+
+// SetUser 設定使用者，用在沒有經過 middleware.JWT 的地方，如 rmq 的訊息帶有使用者時
+func (c *Context) SetUser(userID string, cl claims.Claims) {
+	c.userID = userID
+	c.claims = cl
+}
+
+// Set 保存 key 對應的資料，同一個請求的 Context 都可以讀取
+func (c *Context) Set(key string, value any) {
+	s := c.values()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+}
+
+// Get 讀取 Set 保存的資料
+func (c *Context) Get(key string) (value any, exists bool) {
+	s := c.values()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, exists = s.m[key]
+	return
+}
+
+// Append 將 value 加到 key 對應的 []any 中，用在 SQL 及對外呼叫的紀錄
+func (c *Context) Append(key string, value any) {
+	s := c.values()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logs, _ := s.m[key].([]any)
+	s.m[key] = append(logs, value)
+}
+
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.parent().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	return c.parent().Done()
+}
+
+func (c *Context) Err() error {
+	return c.parent().Err()
+}
+
+// Value 讀取 Context 的值，Set 保存的資料只能以 Get 讀取
+func (c *Context) Value(key any) any {
+	if _, ok := key.(contextKey); ok {
+		return c
+	}
+	return c.parent().Value(key)
+}
+
+func (c *Context) parent() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
+}
+
+// values 直接使用 struct 建立的 Context 在第一次使用時建立 store，此時不可同時在多個 goroutine 使用
+func (c *Context) values() *store {
+	if c.store == nil {
+		c.store = newStore()
 	}
+	return c.store
+}
+
+type store struct {
+	mu sync.Mutex
+	m  map[string]any
+}
+
+func newStore() *store {
+	return &store{m: map[string]any{}}
+}
+
+// ginStore 取得請求共用的 store，沒有時建立並保存在 gin.Context 中
+func ginStore(c *gin.Context) *store {
+	if v, ok := c.Get(consts.KeyStore); ok {
+		if s, ok := v.(*store); ok {
+			return s
+		}
+	}
+
+	s := newStore()
+	c.Set(consts.KeyStore, s)
+	return s
 }
@@ -1,18 +1,75 @@
 package delivery
 
 import (
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/win30221/core/basic"
 	"github.com/win30221/core/http/middleware"
+	"github.com/win30221/core/http/sign"
 )
 
-func SetBasicRouter(e *gin.Engine) (publicGroup, privateGroup *gin.RouterGroup) {
+// RouterConfig SetBasicRouter、NewBasicRouter 的設定
+type RouterConfig struct {
+	// Verifier 有值時 private group 接受 http/sign 的簽章，參考 middleware.InternalAuth
+	Verifier *sign.Verifier
+	// DisableSysToken 所有呼叫端都改用簽章後設為 true，private group 不再接受 SysToken，需要同時設定 Verifier
+	DisableSysToken bool
+}
+
+// SetBasicRouter 建立 public 及 private group，private group 需要通過 middleware.NetworkConsulPath 的 IP 限制，
+// 以及 SysToken 或簽章（有設定 RouterConfig.Verifier 時）的驗證。
+// NetworkPolicy 有設定 trusted_proxies 時才會變更 e 信任的 proxy，設定錯誤時直接結束程式，需要自行處理錯誤時使用 NewBasicRouter
+//
+// example:
+//
+//	sign.Init(time.Minute)
+//	publicGroup, privateGroup := delivery.SetBasicRouter(e, delivery.RouterConfig{
+//		Verifier: sign.NewVerifier(sign.Keys, sign.NewRedisNonceStore(rdb)),
+//	})
+func SetBasicRouter(e *gin.Engine, conf ...RouterConfig) (publicGroup, privateGroup *gin.RouterGroup) {
+	var c RouterConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+
+	publicGroup, privateGroup, err := NewBasicRouter(e, c)
+	if err != nil {
+		log.Fatalf("set basic router error: %s", err)
+	}
+	return
+}
+
+// NewBasicRouter 與 SetBasicRouter 相同，設定錯誤時回傳錯誤
+func NewBasicRouter(e *gin.Engine, c RouterConfig) (publicGroup, privateGroup *gin.RouterGroup, err error) {
+	network := middleware.GetNetworkPolicy(middleware.NetworkConsulPath)
+	if err = network.ApplyTrustedProxies(e); err != nil {
+		err = fmt.Errorf("%s, path: %s", err.Error(), middleware.NetworkConsulPath)
+		return
+	}
+
+	sysTokens := append([]string{basic.SysToken}, basic.SysTokens...)
+	auth := middleware.ValidateToken(sysTokens...)
+	switch {
+	case c.Verifier != nil && c.DisableSysToken:
+		auth = middleware.InternalAuth(c.Verifier)
+	case c.Verifier != nil:
+		auth = middleware.InternalAuth(c.Verifier, sysTokens...)
+	case c.DisableSysToken:
+		err = errors.New("DisableSysToken requires Verifier")
+		return
+	}
+
 	publicGroup = e.Group("/" + basic.ServerName)
-	privateGroup = e.Group("/"+basic.ServerName, middleware.ValidateToken(basic.SysToken))
+	privateGroup = e.Group("/"+basic.ServerName,
+		middleware.IPAllowlist(network),
+		auth,
+		middleware.NoCache(),
+	)
 
 	if basic.Site != "prd" {
 		ginSwagger.WrapHandler(swaggerfiles.Handler,
@@ -0,0 +1,272 @@
+/*
+package i18n 管理錯誤代碼對應各語系的訊息，response 會依照 ctx.Context 的 Lang 回傳翻譯後的訊息，
+找不到翻譯時則回傳 catch 錯誤中原本的 OutputMsg。
+
+訊息中可以使用 `{{key}}` 作為插值參數，參數由 catch.WithParams 帶入。
+*/
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"github.com/win30221/core/config"
+)
+
+var (
+	// DefaultLang 當 request 沒有指定語系，或指定的語系不存在於 catalog 中時使用
+	DefaultLang = ""
+
+	mu sync.RWMutex
+	// messages lang -> code -> message
+	messages = map[string]map[string]string{}
+)
+
+// Normalize 統一語系格式，例如 "zh_TW"、"ZH-tw" 都會轉為 "zh-tw"
+func Normalize(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+// Register 註冊單一錯誤代碼的翻譯，通常在 service package 的 init 中使用
+func Register(lang, code, message string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lang = Normalize(lang)
+	if _, ok := messages[lang]; !ok {
+		messages[lang] = map[string]string{}
+	}
+	messages[lang][code] = message
+}
+
+// Load 合併整份 catalog，格式為 lang -> code -> message
+func Load(catalog map[string]map[string]string) {
+	for lang, m := range catalog {
+		for code, message := range m {
+			Register(lang, code, message)
+		}
+	}
+}
+
+// LoadFile 從本機檔案載入 catalog，檔案格式依副檔名決定（json, toml, yaml）
+//
+// example (toml):
+//
+//	[zh-tw]
+//	"11" = "參數錯誤: {{error}}"
+//	[en]
+//	"11" = "invalid parameter: {{error}}"
+func LoadFile(path string) (err error) {
+	vObj := viper.New()
+	vObj.SetConfigFile(path)
+
+	err = vObj.ReadInConfig()
+	if err != nil {
+		err = fmt.Errorf("read i18n file `%s` error: %s", path, err.Error())
+		return
+	}
+
+	Load(toCatalog(vObj.AllSettings()))
+
+	return
+}
+
+// LoadConsul 從 consul 載入 catalog
+//
+// 假設 consul 路徑 "/system/i18n" 內有下列資料
+// `
+//
+//	[messages.zh-tw]
+//	"11" = "參數錯誤: {{error}}"
+//	[messages.en]
+//	"11" = "invalid parameter: {{error}}"
+//
+// `
+//
+// LoadConsul("/system/i18n/messages", false)
+func LoadConsul(key string, existOnErr bool) (err error) {
+	err = config.Get(key, existOnErr, func(res any) (err error) {
+		m, ok := res.(map[string]any)
+		if !ok {
+			err = config.ErrOnTypeIncorrect
+			return
+		}
+
+		Load(toCatalog(m))
+		return
+	})
+	return
+}
+
+func toCatalog(m map[string]any) (res map[string]map[string]string) {
+	res = map[string]map[string]string{}
+	for lang, v := range m {
+		res[lang] = cast.ToStringMapString(v)
+	}
+	return
+}
+
+// Languages 回傳目前 catalog 中所有的語系
+func Languages() (res []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for lang := range messages {
+		res = append(res, lang)
+	}
+	sort.Strings(res)
+
+	return
+}
+
+// Supported 檢查語系是否存在於 catalog 中，如 "zh-tw" 不存在時會再找 "zh"
+func Supported(lang string) (res string, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	lang = Normalize(lang)
+	if lang == "" {
+		return
+	}
+
+	if _, ok = messages[lang]; ok {
+		res = lang
+		return
+	}
+
+	base, _, found := strings.Cut(lang, "-")
+	if !found {
+		return
+	}
+
+	if _, ok = messages[base]; ok {
+		res = base
+	}
+
+	return
+}
+
+// Message 取得錯誤代碼在指定語系的訊息，找不到時會再找 DefaultLang
+func Message(lang, code string) (res string, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, l := range []string{lang, DefaultLang} {
+		l = Normalize(l)
+		if l == "" {
+			continue
+		}
+
+		if res, ok = messages[l][code]; ok {
+			return
+		}
+
+		base, _, found := strings.Cut(l, "-")
+		if !found {
+			continue
+		}
+
+		if res, ok = messages[base][code]; ok {
+			return
+		}
+	}
+
+	return
+}
+
+// Translate 取得錯誤代碼翻譯後的訊息並帶入參數，找不到翻譯時使用 fallback
+func Translate(lang, code, fallback string, params map[string]any) string {
+	message, ok := Message(lang, code)
+	if !ok {
+		message = fallback
+	}
+
+	return Interpolate(message, params)
+}
+
+// Interpolate 將訊息中的 `{{key}}` 替換為 params 中對應的值
+func Interpolate(message string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(message, "{{") {
+		return message
+	}
+
+	oldnew := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		oldnew = append(oldnew, "{{"+k+"}}", cast.ToString(v))
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(message)
+}
+
+// Resolve 依照 Lang 與 Accept-Language 標頭決定 request 使用的語系。
+// Lang 優先，其次是 Accept-Language 中權重最高且存在於 catalog 的語系，最後使用 DefaultLang
+func Resolve(lang, acceptLanguage string) string {
+	if l, ok := Supported(lang); ok {
+		return l
+	}
+
+	for _, l := range ParseAcceptLanguage(acceptLanguage) {
+		if l, ok := Supported(l); ok {
+			return l
+		}
+	}
+
+	// catalog 為空時保留 client 傳入的語系，讓 service 自行處理
+	if len(Languages()) == 0 && lang != "" {
+		return Normalize(lang)
+	}
+
+	return Normalize(DefaultLang)
+}
+
+// ParseAcceptLanguage 解析 Accept-Language 標頭，依照權重由高到低排序
+//
+// example:
+//
+//	ParseAcceptLanguage("zh-TW,zh;q=0.9,en;q=0.8")
+//	// return: []string{"zh-tw", "zh", "en"}
+func ParseAcceptLanguage(header string) (res []string) {
+	type tag struct {
+		lang string
+		q    float64
+	}
+
+	tags := []tag{}
+	for _, part := range strings.Split(header, ",") {
+		lang, param, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = Normalize(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		tags = append(tags, tag{lang: lang, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	for _, t := range tags {
+		res = append(res, t.lang)
+	}
+
+	return
+}
@@ -0,0 +1,74 @@
+// package claims 定義 JWT 的 claims，只依賴標準函式庫，讓 ctx 等 package 不需要 import http/jwt
+package claims
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Claims JWT 的 payload，數字會以 json.Number 保留
+type Claims map[string]any
+
+// String 取得字串型別的 claim，不存在或型別不符時回傳空字串
+func (c Claims) String(key string) string {
+	s, _ := c[key].(string)
+	return s
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+func (c Claims) ID() string {
+	return c.String("jti")
+}
+
+// Audience aud 可以是字串或字串陣列
+func (c Claims) Audience() (res []string) {
+	switch v := c["aud"].(type) {
+	case string:
+		res = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+	case []string:
+		res = v
+	}
+	return
+}
+
+// Time 取得 NumericDate 型別的 claim（如 exp, nbf, iat）
+func (c Claims) Time(key string) (t time.Time, ok bool) {
+	var sec float64
+	switch v := c[key].(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return
+		}
+		sec = f
+	case float64:
+		sec = v
+	case int64:
+		sec = float64(v)
+	case int:
+		sec = float64(v)
+	default:
+		return
+	}
+
+	whole := int64(sec)
+	t, ok = time.Unix(whole, int64((sec-float64(whole))*1e9)), true
+	return
+}
+
+func (c Claims) ExpiresAt() (time.Time, bool) {
+	return c.Time("exp")
+}
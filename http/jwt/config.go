@@ -0,0 +1,229 @@
+package jwt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/win30221/core/config"
+)
+
+// GetVerifier 從 consul 載入設定並建立 Verifier
+//
+// 假設 consul 路徑 "/system/jwt" 內有下列資料
+// `
+//
+//	issuer = "auth"
+//	audience = "app,backoffice"
+//	leeway = "30s"
+//	user_id_claim = "sub"
+//	ttl = "2h"
+//	signing_key = "k2"
+//	jwks_file = "/etc/jwt/jwks.json"
+//	[keys.k1]
+//	alg = "HS256"
+//	secret = "..."
+//	[keys.k2]
+//	alg = "RS256"
+//	public_key = """-----BEGIN PUBLIC KEY-----..."""
+//	private_key_file = "/etc/jwt/k2.pem"
+//
+// `
+//
+// keys 與 jwks_file（或 jwks 直接放 JSON）可以擇一或同時使用，kid 為小寫。
+// ttl、signing_key 及 private_key/private_key_file 只有 GetSigner 會使用，其他服務不需要設定私鑰
+func GetVerifier(path string) (v *Verifier) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Fatalf("get jwt verifier error: %s \n - path %s", err, path)
+		}
+	}()
+
+	m, err := config.GetValues(path, false)
+	if err != nil {
+		return
+	}
+
+	keys, err := parseKeys(m)
+	if err != nil {
+		return
+	}
+
+	v = NewVerifier(NewKeySet(keys...))
+	v.Issuer = m.String("issuer")
+	v.Audience = m.Strings("audience")
+	if leeway, e := time.ParseDuration(m.String("leeway")); e == nil {
+		v.Leeway = leeway
+	}
+	if m.String("user_id_claim") != "" {
+		v.UserIDClaim = m.String("user_id_claim")
+	}
+
+	return
+}
+
+// GetSigner 從 consul 載入設定並建立 Signer，設定格式參考 GetVerifier
+func GetSigner(path string) (s *Signer) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Fatalf("get jwt signer error: %s \n - path %s", err, path)
+		}
+	}()
+
+	m, err := config.GetValues(path, false)
+	if err != nil {
+		return
+	}
+
+	keys, err := parseKeys(m)
+	if err != nil {
+		return
+	}
+
+	id := strings.ToLower(m.String("signing_key"))
+	for _, k := range keys {
+		if k.ID == id && (len(k.Secret) > 0 || k.Private != nil) {
+			s = &Signer{Key: k}
+			break
+		}
+	}
+	if s == nil {
+		err = fmt.Errorf("signing key `%s` not found or has no private key", id)
+		return
+	}
+
+	s.Issuer = m.String("issuer")
+	s.Audience = m.Strings("audience")
+	s.TTL, err = time.ParseDuration(m.String("ttl"))
+	if err != nil {
+		err = fmt.Errorf("parse ttl error: %s", err.Error())
+		return
+	}
+	if s.TTL <= 0 {
+		err = fmt.Errorf("ttl must be greater than 0")
+		return
+	}
+
+	return
+}
+
+func parseKeys(m config.Values) (res []Key, err error) {
+	// k example: keys.k1.alg
+	ids := map[string]bool{}
+	for k := range m {
+		rest, found := strings.CutPrefix(k, "keys.")
+		if !found {
+			continue
+		}
+		if i := strings.LastIndex(rest, "."); i > 0 {
+			ids[rest[:i]] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		var key Key
+		key, err = parseKey(id, func(field string) string { return m.String("keys." + id + "." + field) })
+		if err != nil {
+			return
+		}
+		res = append(res, key)
+	}
+
+	if m.String("jwks") != "" {
+		var keys []Key
+		keys, err = ParseJWKS([]byte(m.String("jwks")))
+		if err != nil {
+			return
+		}
+		res = append(res, keys...)
+	}
+
+	if m.String("jwks_file") != "" {
+		var keys []Key
+		keys, err = LoadJWKSFile(m.String("jwks_file"))
+		if err != nil {
+			return
+		}
+		res = append(res, keys...)
+	}
+
+	if len(res) == 0 {
+		err = fmt.Errorf("no jwt key configured")
+	}
+
+	return
+}
+
+func parseKey(id string, get func(field string) string) (key Key, err error) {
+	key = Key{ID: id, Alg: strings.ToUpper(get("alg"))}
+
+	switch key.Alg {
+	case HS256:
+		if get("secret") == "" {
+			err = fmt.Errorf("key `%s` missing secret", id)
+			return
+		}
+		key.Secret = []byte(get("secret"))
+		return
+	case RS256, ES256:
+	default:
+		err = fmt.Errorf("key `%s` unsupported alg `%s`", id, key.Alg)
+		return
+	}
+
+	if pemBytes, e := readPEM(get("public_key"), get("public_key_file")); e != nil {
+		err = fmt.Errorf("key `%s` %s", id, e.Error())
+		return
+	} else if pemBytes != nil {
+		if key.Public, err = ParsePublicKey(pemBytes); err != nil {
+			err = fmt.Errorf("key `%s` parse public key error: %s", id, err.Error())
+			return
+		}
+	}
+
+	if pemBytes, e := readPEM(get("private_key"), get("private_key_file")); e != nil {
+		err = fmt.Errorf("key `%s` %s", id, e.Error())
+		return
+	} else if pemBytes != nil {
+		if key.Private, err = ParsePrivateKey(pemBytes); err != nil {
+			err = fmt.Errorf("key `%s` parse private key error: %s", id, err.Error())
+			return
+		}
+	}
+
+	if key.public() == nil {
+		err = fmt.Errorf("key `%s` missing public key", id)
+	}
+
+	return
+}
+
+func readPEM(inline, file string) (res []byte, err error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+
+	if file == "" {
+		return
+	}
+
+	res, err = os.ReadFile(file)
+	if err != nil {
+		err = fmt.Errorf("read pem file `%s` error: %s", file, err.Error())
+	}
+
+	return
+}
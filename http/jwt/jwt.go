@@ -0,0 +1,343 @@
+/*
+package jwt 實作 HS256/RS256/ES256 的 JWT 簽署及驗證，驗證用在 middleware.JWT，簽署用在 auth 服務發 token。
+
+金鑰可以從 consul（GetVerifier/GetSigner）或本機的 JWKS 檔案（LoadJWKSFile）載入。
+*/
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/win30221/core/http/jwt/claims"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	ErrMalformed     = errors.New("malformed token")
+	ErrAlgorithm     = errors.New("unsupported algorithm")
+	ErrUnknownKey    = errors.New("unknown key")
+	ErrSignature     = errors.New("signature mismatch")
+	ErrExpired       = errors.New("token expired")
+	ErrNotValidYet   = errors.New("token not valid yet")
+	ErrMissingExpiry = errors.New("missing exp claim")
+	ErrIssuer        = errors.New("issuer mismatch")
+	ErrAudience      = errors.New("audience mismatch")
+)
+
+var encoding = base64.RawURLEncoding
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Claims JWT 的 payload，定義在 http/jwt/claims 讓 ctx 不需要依賴 jwt 的實作
+type Claims = claims.Claims
+
+// Verifier 驗證 token 的簽章及 iss/aud/exp/nbf/iat
+type Verifier struct {
+	Keys *KeySet
+	// Issuer 有值時 iss 必須相同
+	Issuer string
+	// Audience 有值時 aud 必須包含其中一個
+	Audience []string
+	// Leeway 檢查時間時允許的誤差
+	Leeway time.Duration
+	// UserIDClaim ctx.Context.UserID() 使用的 claim，預設為 sub
+	UserIDClaim string
+}
+
+func NewVerifier(keys *KeySet) *Verifier {
+	return &Verifier{
+		Keys:        keys,
+		Leeway:      30 * time.Second,
+		UserIDClaim: "sub",
+	}
+}
+
+// Verify 驗證 token 並回傳 claims，token 必須有 exp
+func (v *Verifier) Verify(token string) (claims Claims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = ErrMalformed
+		return
+	}
+
+	h := header{}
+	if err = decodeSegment(parts[0], &h); err != nil {
+		return
+	}
+
+	if h.Alg != HS256 && h.Alg != RS256 && h.Alg != ES256 {
+		err = fmt.Errorf("%w: %s", ErrAlgorithm, h.Alg)
+		return
+	}
+
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		err = fmt.Errorf("%w: decode signature error: %s", ErrMalformed, err.Error())
+		return
+	}
+
+	// 金鑰的演算法必須與 header 相同，避免以 HS256 搭配公鑰偽造簽章
+	keys := v.Keys.lookup(h.Kid, h.Alg)
+	if len(keys) == 0 {
+		err = fmt.Errorf("%w: kid %s, alg %s", ErrUnknownKey, h.Kid, h.Alg)
+		return
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if verify(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		err = ErrSignature
+		return
+	}
+
+	claims = Claims{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		claims = nil
+		return
+	}
+
+	if err = v.validate(claims, time.Now()); err != nil {
+		claims = nil
+		return
+	}
+
+	return
+}
+
+func (v *Verifier) validate(claims Claims, now time.Time) (err error) {
+	exp, ok := claims.ExpiresAt()
+	if !ok {
+		return ErrMissingExpiry
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return ErrExpired
+	}
+
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrNotValidYet
+	}
+
+	if iat, ok := claims.Time("iat"); ok && now.Add(v.Leeway).Before(iat) {
+		return ErrNotValidYet
+	}
+
+	if v.Issuer != "" && claims.Issuer() != v.Issuer {
+		return fmt.Errorf("%w: %s", ErrIssuer, claims.Issuer())
+	}
+
+	if len(v.Audience) > 0 && !intersect(v.Audience, claims.Audience()) {
+		return fmt.Errorf("%w: %v", ErrAudience, claims.Audience())
+	}
+
+	return
+}
+
+// Signer 簽發 token，用在 auth 服務
+type Signer struct {
+	Key      Key
+	Issuer   string
+	Audience []string
+	// TTL 簽發的 token 有效時間，claims 已有 exp 時不會覆寫。
+	// Verifier 不接受沒有 exp 的 token，所以 TTL 為 0 時 claims 必須自帶 exp
+	TTL time.Duration
+}
+
+func NewSigner(key Key, issuer string, ttl time.Duration) *Signer {
+	return &Signer{Key: key, Issuer: issuer, TTL: ttl}
+}
+
+// Issue 簽發 subject 的 token，extra 為額外的 claims（如 role）
+//
+// example:
+//
+//	token, err := signer.Issue(strconv.Itoa(user.ID), jwt.Claims{"role": user.Role})
+func (s *Signer) Issue(subject string, extra Claims) (token string, err error) {
+	claims := Claims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["sub"] = subject
+
+	return s.Sign(claims)
+}
+
+// Sign 簽署 claims，未設定的 iss/aud/iat/nbf/exp/jti 會自動補上，
+// claims 沒有 exp 且 TTL 不大於 0 時回傳 ErrMissingExpiry
+func (s *Signer) Sign(claims Claims) (token string, err error) {
+	now := time.Now()
+
+	if _, ok := claims["exp"]; !ok && s.TTL <= 0 {
+		err = fmt.Errorf("%w: ttl is not set", ErrMissingExpiry)
+		return
+	}
+
+	c := Claims{}
+	for k, v := range claims {
+		c[k] = v
+	}
+	setDefault(c, "iss", s.Issuer, s.Issuer != "")
+	setDefault(c, "aud", s.Audience, len(s.Audience) > 0)
+	setDefault(c, "iat", now.Unix(), true)
+	setDefault(c, "nbf", now.Unix(), true)
+	setDefault(c, "exp", now.Add(s.TTL).Unix(), s.TTL > 0)
+
+	if _, ok := c["jti"]; !ok {
+		b := make([]byte, 16)
+		if _, err = rand.Read(b); err != nil {
+			err = fmt.Errorf("generate jti error: %w", err)
+			return
+		}
+		c["jti"] = hex.EncodeToString(b)
+	}
+
+	h, err := json.Marshal(header{Alg: s.Key.Alg, Kid: s.Key.ID, Typ: "JWT"})
+	if err != nil {
+		return
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		err = fmt.Errorf("marshal claims error: %w", err)
+		return
+	}
+
+	signed := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+
+	sig, err := sign(s.Key, []byte(signed))
+	if err != nil {
+		return
+	}
+
+	token = signed + "." + encoding.EncodeToString(sig)
+
+	return
+}
+
+func setDefault(c Claims, key string, value any, ok bool) {
+	if _, exist := c[key]; !exist && ok {
+		c[key] = value
+	}
+}
+
+func sign(k Key, signed []byte) (sig []byte, err error) {
+	digest := sha256.Sum256(signed)
+
+	switch k.Alg {
+	case HS256:
+		if len(k.Secret) == 0 {
+			err = fmt.Errorf("%w: missing secret of %s", ErrUnknownKey, k.ID)
+			return
+		}
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(signed)
+		sig = mac.Sum(nil)
+	case RS256:
+		priv, ok := k.Private.(*rsa.PrivateKey)
+		if !ok {
+			err = fmt.Errorf("%w: missing rsa private key of %s", ErrUnknownKey, k.ID)
+			return
+		}
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case ES256:
+		priv, ok := k.Private.(*ecdsa.PrivateKey)
+		if !ok {
+			err = fmt.Errorf("%w: missing ecdsa private key of %s", ErrUnknownKey, k.ID)
+			return
+		}
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return
+		}
+		// JWS 的 ES256 簽章為固定長度的 r || s
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		err = fmt.Errorf("%w: %s", ErrAlgorithm, k.Alg)
+	}
+
+	return
+}
+
+func verify(k Key, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch k.Alg {
+	case HS256:
+		if len(k.Secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case RS256:
+		pub, ok := k.public().(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		pub, ok := k.public().(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+
+	return false
+}
+
+func decodeSegment(seg string, v any) (err error) {
+	b, err := encoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformed, err.Error())
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err = d.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformed, err.Error())
+	}
+
+	return
+}
+
+func intersect(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
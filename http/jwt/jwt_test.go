@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRSAKey(t *testing.T, id string) Key {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{ID: id, Alg: RS256, Private: priv}
+}
+
+func newECKey(t *testing.T, id string) Key {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{ID: id, Alg: ES256, Private: priv}
+}
+
+// forge 以任意的 header 及 secret 產生 token，用來模擬攻擊者自行簽署的 token
+func forge(h map[string]any, claims Claims, secret []byte) string {
+	hb, _ := json.Marshal(h)
+	cb, _ := json.Marshal(claims)
+	signed := encoding.EncodeToString(hb) + "." + encoding.EncodeToString(cb)
+	if secret == nil {
+		return signed + "."
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + encoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_SignVerify(t *testing.T) {
+	keys := []Key{
+		{ID: "hs", Alg: HS256, Secret: []byte("secret")},
+		newRSAKey(t, "rs"),
+		newECKey(t, "es"),
+	}
+
+	for _, k := range keys {
+		t.Run(k.Alg, func(t *testing.T) {
+			token, err := NewSigner(k, "auth", time.Hour).Issue("42", Claims{"role": "admin"})
+			if err != nil {
+				t.Fatalf("issue error: %v", err)
+			}
+
+			// 驗證端只有公鑰
+			pub := Key{ID: k.ID, Alg: k.Alg, Secret: k.Secret}
+			if k.Private != nil {
+				pub.Public = k.Private.Public()
+			}
+
+			claims, err := NewVerifier(NewKeySet(pub)).Verify(token)
+			if err != nil {
+				t.Fatalf("verify error: %v", err)
+			}
+			if claims.Subject() != "42" || claims.String("role") != "admin" || claims.Issuer() != "auth" || claims.ID() == "" {
+				t.Errorf("claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func Test_Verify_Rejects(t *testing.T) {
+	rsKey := newRSAKey(t, "rs")
+	esKey := newECKey(t, "es")
+	hsKey := Key{ID: "hs", Alg: HS256, Secret: []byte("secret")}
+
+	pubDER, _ := x509.MarshalPKIXPublicKey(rsKey.Private.Public())
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid, _ := NewSigner(rsKey, "", time.Hour).Issue("42", nil)
+	validES, _ := NewSigner(esKey, "", time.Hour).Issue("42", nil)
+	otherKey, _ := NewSigner(newRSAKey(t, "rs"), "", time.Hour).Issue("42", nil)
+	parts := strings.Split(valid, ".")
+	esParts := strings.Split(validES, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{
+			name:  "alg none",
+			token: forge(map[string]any{"alg": "none"}, Claims{"sub": "42", "exp": exp}, nil),
+			want:  ErrAlgorithm,
+		},
+		{
+			name:  "alg none uppercase",
+			token: forge(map[string]any{"alg": "NONE"}, Claims{"sub": "42", "exp": exp}, nil),
+			want:  ErrAlgorithm,
+		},
+		{
+			name:  "HS256 signed with rsa public key",
+			token: forge(map[string]any{"alg": HS256, "kid": "rs"}, Claims{"sub": "42", "exp": exp}, pubPEM),
+			want:  ErrUnknownKey,
+		},
+		{
+			name:  "HS256 signed with rsa public key without kid",
+			token: forge(map[string]any{"alg": HS256}, Claims{"sub": "42", "exp": exp}, pubPEM),
+			want:  ErrSignature,
+		},
+		{
+			name:  "signed by other key",
+			token: otherKey,
+			want:  ErrSignature,
+		},
+		{
+			name:  "tampered payload",
+			token: parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"1","exp":9999999999}`)) + "." + parts[2],
+			want:  ErrSignature,
+		},
+		{
+			name:  "truncated ES256 signature",
+			token: esParts[0] + "." + esParts[1] + "." + esParts[2][:40],
+			want:  ErrSignature,
+		},
+		{
+			name:  "unknown kid",
+			token: forge(map[string]any{"alg": HS256, "kid": "other"}, Claims{"sub": "42", "exp": exp}, []byte("secret")),
+			want:  ErrUnknownKey,
+		},
+		{
+			name:  "missing exp",
+			token: forge(map[string]any{"alg": HS256, "kid": "hs"}, Claims{"sub": "42"}, []byte("secret")),
+			want:  ErrMissingExpiry,
+		},
+		{
+			name:  "two segments",
+			token: parts[0] + "." + parts[1],
+			want:  ErrMalformed,
+		},
+		{
+			name:  "invalid signature encoding",
+			token: parts[0] + "." + parts[1] + ".***",
+			want:  ErrMalformed,
+		},
+	}
+
+	v := NewVerifier(NewKeySet(
+		Key{ID: "rs", Alg: RS256, Public: rsKey.Private.Public()},
+		Key{ID: "es", Alg: ES256, Public: esKey.Private.Public()},
+		hsKey,
+	))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if claims != nil {
+				t.Errorf("claims should be nil: %+v", claims)
+			}
+		})
+	}
+}
+
+func Test_validate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	tests := []struct {
+		name     string
+		issuer   string
+		audience []string
+		claims   Claims
+		want     error
+	}{
+		{name: "valid", claims: Claims{"exp": at(time.Minute)}},
+		{name: "expired within leeway", claims: Claims{"exp": at(-20 * time.Second)}},
+		{name: "expired", claims: Claims{"exp": at(-time.Minute)}, want: ErrExpired},
+		{name: "exp equals now minus leeway", claims: Claims{"exp": at(-30 * time.Second)}, want: ErrExpired},
+		{name: "nbf within leeway", claims: Claims{"exp": at(time.Hour), "nbf": at(20 * time.Second)}},
+		{name: "nbf in future", claims: Claims{"exp": at(time.Hour), "nbf": at(time.Minute)}, want: ErrNotValidYet},
+		{name: "iat in future", claims: Claims{"exp": at(time.Hour), "iat": at(time.Minute)}, want: ErrNotValidYet},
+		{name: "fractional exp", claims: Claims{"exp": json.Number("1717200060.5")}},
+		{name: "issuer", issuer: "auth", claims: Claims{"exp": at(time.Hour), "iss": "auth"}},
+		{name: "wrong issuer", issuer: "auth", claims: Claims{"exp": at(time.Hour), "iss": "other"}, want: ErrIssuer},
+		{name: "missing issuer", issuer: "auth", claims: Claims{"exp": at(time.Hour)}, want: ErrIssuer},
+		{name: "audience", audience: []string{"app", "backoffice"}, claims: Claims{"exp": at(time.Hour), "aud": "app"}},
+		{name: "audience list", audience: []string{"app", "backoffice"}, claims: Claims{"exp": at(time.Hour), "aud": []any{"web", "backoffice"}}},
+		{name: "wrong audience", audience: []string{"app", "backoffice"}, claims: Claims{"exp": at(time.Hour), "aud": "web"}, want: ErrAudience},
+		{name: "missing audience", audience: []string{"app", "backoffice"}, claims: Claims{"exp": at(time.Hour)}, want: ErrAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(NewKeySet())
+			v.Issuer = tt.issuer
+			v.Audience = tt.audience
+
+			if err := v.validate(tt.claims, now); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Sign_RequiresExpiry(t *testing.T) {
+	s := NewSigner(Key{ID: "hs", Alg: HS256, Secret: []byte("secret")}, "auth", 0)
+
+	if _, err := s.Issue("42", nil); !errors.Is(err, ErrMissingExpiry) {
+		t.Errorf("err = %v, want %v", err, ErrMissingExpiry)
+	}
+
+	token, err := s.Sign(Claims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sign with exp error: %v", err)
+	}
+	if _, err = NewVerifier(NewKeySet(s.Key)).Verify(token); err != nil {
+		t.Errorf("verify error: %v", err)
+	}
+}
+
+func Test_ParseJWKS_AlgMismatch(t *testing.T) {
+	_, err := ParseJWKS([]byte(`{"keys":[{"kty":"RSA","kid":"rs","alg":"HS256","n":"AQAB","e":"AQAB"}]}`))
+	if err == nil {
+		t.Errorf("rsa key with HS256 alg should be rejected")
+	}
+
+	keys, err := ParseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"hs","k":"c2VjcmV0"},{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}]}`))
+	if err != nil || len(keys) != 1 || keys[0].Alg != HS256 || string(keys[0].Secret) != "secret" {
+		t.Errorf("keys: %+v, err: %v", keys, err)
+	}
+}
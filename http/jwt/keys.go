@@ -0,0 +1,225 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+)
+
+// Key 單一金鑰，HS256 使用 Secret，RS256/ES256 驗證使用 Public、簽署使用 Private
+type Key struct {
+	ID      string
+	Alg     string
+	Secret  []byte
+	Public  crypto.PublicKey
+	Private crypto.Signer
+}
+
+func (k Key) public() crypto.PublicKey {
+	if k.Public == nil && k.Private != nil {
+		return k.Private.Public()
+	}
+	return k.Public
+}
+
+// KeySet 驗證用的金鑰，可以同時放多把以便輪替
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+func NewKeySet(keys ...Key) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// Set 取代所有金鑰，重新載入金鑰時使用
+func (s *KeySet) Set(keys ...Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+}
+
+func (s *KeySet) Add(keys ...Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = append(s.keys, keys...)
+}
+
+// lookup token 有 kid 時只回傳相同 id 的金鑰，否則回傳所有相同演算法的金鑰
+func (s *KeySet) lookup(kid, alg string) (res []Key) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.keys {
+		if k.Alg != alg {
+			continue
+		}
+		if kid != "" && k.ID != kid {
+			continue
+		}
+		res = append(res, k)
+	}
+
+	return
+}
+
+// ParsePublicKey 解析 PEM 格式的公鑰（PKIX 或 PKCS1）或憑證
+func ParsePublicKey(b []byte) (res crypto.PublicKey, err error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		err = fmt.Errorf("decode pem error")
+		return
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return
+		}
+		res = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		res, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		res, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	return
+}
+
+// ParsePrivateKey 解析 PEM 格式的私鑰（PKCS8、PKCS1 或 EC）
+func ParsePrivateKey(b []byte) (res crypto.Signer, err error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		err = fmt.Errorf("decode pem error")
+		return
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		res, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		res, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		var key any
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return
+		}
+		var ok bool
+		if res, ok = key.(crypto.Signer); !ok {
+			err = fmt.Errorf("unsupported private key type %T", key)
+		}
+	}
+
+	return
+}
+
+// kty 各演算法對應的 JWK 金鑰類型
+var kty = map[string]string{HS256: "oct", RS256: "RSA", ES256: "EC"}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+// ParseJWKS 解析 JWKS（RFC 7517），支援 RSA、EC P-256 及 oct 金鑰，非簽章用途（use 不是 sig）的金鑰會被略過
+func ParseJWKS(b []byte) (res []Key, err error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err = json.Unmarshal(b, &set); err != nil {
+		err = fmt.Errorf("unmarshal jwks error: %w", err)
+		return
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key := Key{ID: k.Kid, Alg: k.Alg}
+
+		switch k.Kty {
+		case "RSA":
+			var n, e []byte
+			if n, err = encoding.DecodeString(k.N); err != nil {
+				return nil, fmt.Errorf("decode jwk %s error: %w", k.Kid, err)
+			}
+			if e, err = encoding.DecodeString(k.E); err != nil {
+				return nil, fmt.Errorf("decode jwk %s error: %w", k.Kid, err)
+			}
+			key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if key.Alg == "" {
+				key.Alg = RS256
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			var x, y []byte
+			if x, err = encoding.DecodeString(k.X); err != nil {
+				return nil, fmt.Errorf("decode jwk %s error: %w", k.Kid, err)
+			}
+			if y, err = encoding.DecodeString(k.Y); err != nil {
+				return nil, fmt.Errorf("decode jwk %s error: %w", k.Kid, err)
+			}
+			key.Public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if key.Alg == "" {
+				key.Alg = ES256
+			}
+		case "oct":
+			if key.Secret, err = encoding.DecodeString(k.K); err != nil {
+				return nil, fmt.Errorf("decode jwk %s error: %w", k.Kid, err)
+			}
+			if key.Alg == "" {
+				key.Alg = HS256
+			}
+		default:
+			continue
+		}
+
+		// alg 必須與金鑰類型相符，避免 RSA 公鑰被當作 HS256 的 secret
+		if kty[key.Alg] != k.Kty {
+			err = fmt.Errorf("jwk %s alg `%s` does not match kty `%s`", k.Kid, key.Alg, k.Kty)
+			return nil, err
+		}
+
+		res = append(res, key)
+	}
+
+	return
+}
+
+// LoadJWKSFile 從本機的 JWKS 檔案載入金鑰
+func LoadJWKSFile(path string) (res []Key, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("read jwks file `%s` error: %w", path, err)
+		return
+	}
+
+	return ParseJWKS(b)
+}
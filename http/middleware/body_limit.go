@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+// BodyLimit 限制請求 body 的大小（byte），Content-Length 超過時直接回傳 413 及 syserrno.RequestTooLarge，
+// 沒有 Content-Length（如 chunked 或經過 Compress 解壓縮）時在讀取超過後回傳錯誤，
+// 之後 response.Error 都會改為回傳 413
+//
+// example:
+//
+//	privateGroup.POST("/image", middleware.BodyLimit(10<<20), delivery.UploadImage)
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.Set(consts.KeyBodyTooLarge, true)
+			ctx := ctx.New(c, c.Request.Context())
+			response.Error(ctx, http.StatusRequestEntityTooLarge, bodyTooLargeError(limit))
+			c.Abort()
+			return
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = &limitedBody{
+				ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit),
+				exceeded:   func() { c.Set(consts.KeyBodyTooLarge, true) },
+			}
+		}
+
+		c.Next()
+
+		// handler 忽略讀取錯誤且沒有回應時
+		if c.GetBool(consts.KeyBodyTooLarge) && !c.Writer.Written() {
+			ctx := ctx.New(c, c.Request.Context())
+			response.Error(ctx, http.StatusRequestEntityTooLarge, bodyTooLargeError(limit))
+		}
+	}
+}
+
+func bodyTooLargeError(limit int64) error {
+	return catch.New(
+		syserrno.RequestTooLarge,
+		"request body too large",
+		fmt.Sprintf("request body is larger than %d bytes", limit),
+	)
+}
+
+// limitedBody 讀取超過限制時通知 BodyLimit
+type limitedBody struct {
+	io.ReadCloser
+	exceeded func()
+}
+
+func (b *limitedBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if _, ok := err.(*http.MaxBytesError); ok {
+		b.exceeded()
+	}
+	return
+}
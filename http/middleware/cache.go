@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/storage/rdb"
+	"github.com/win30221/core/syserrno"
+	"go.uber.org/zap"
+)
+
+const (
+	cacheKeyPrefix = "cache:"
+	cacheTagPrefix = "cache:tag:"
+	// keyNoCache 由 NoCache 設定在 gin.Context 中
+	keyNoCache = "noCache"
+)
+
+// CachePolicy 路由的快取規則
+type CachePolicy struct {
+	// TTL 回應保存在 redis 的時間
+	TTL time.Duration
+	// MaxAge 回傳給 client 的 Cache-Control max-age，0 時回傳 no-cache（client 每次都需要以 ETag 確認）
+	MaxAge time.Duration
+	// VaryHeaders 會影響回應內容的標頭（如 Lang），會加入 cache key 及 Vary
+	VaryHeaders []string
+	// IgnoreQuery 不影響回應內容的 query（如 utm_source），不會加入 cache key
+	IgnoreQuery []string
+	// Tags 用來讓 InvalidateCache 清除快取，可以使用路由參數，如 "order:{id}"
+	Tags []string
+}
+
+// cacheEntry 保存在 redis 中的回應
+type cacheEntry struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	ETag        string `json:"etag"`
+	Body        []byte `json:"body"`
+}
+
+// Cache 將 GET、HEAD 成功（http 200 且 status.code 為 syserrno.OK）的 response.Response 保存在 redis，
+// key 由路徑、排序後的 query 及 VaryHeaders 組成。回應會帶上 ETag 及 Cache-Control，
+// If-None-Match 相符時回傳 304，請求帶有 Cache-Control: no-cache 時會重新產生回應。
+//
+// 下列請求不會使用快取，避免使用者之間共用回應：
+//   - 經過 NoCache 的路由（如 private group）
+//   - 帶有 Authorization 或通過 JWT、VerifySignature 驗證的請求
+//
+// 回應會先暫存在記憶體中，不可以用在串流的路由。redis 發生錯誤時略過快取並記錄 log
+//
+// example:
+//
+//	publicGroup.GET("/order/:id", middleware.Cache(rdb, middleware.CachePolicy{TTL: time.Minute, Tags: []string{"order:{id}"}}), delivery.GetOrder)
+func Cache(client *redis.Client, p CachePolicy) gin.HandlerFunc {
+	cacheControl := "no-cache"
+	if p.MaxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+
+	return func(c *gin.Context) {
+		if (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) || cacheBypassed(c) {
+			c.Next()
+			return
+		}
+
+		ctx := ctx.New(c, c.Request.Context())
+		key := cacheKey(c, p)
+
+		h := c.Writer.Header()
+		for _, name := range p.VaryHeaders {
+			h.Add("Vary", name)
+		}
+
+		if !strings.Contains(c.Request.Header.Get("Cache-Control"), "no-cache") {
+			var e cacheEntry
+			if err := rdb.Get(ctx, client, key, &e); err != nil {
+				zap.L().Warn("cache store error: "+err.Error(), zap.String("key", key))
+			}
+			if e.ETag != "" {
+				h.Set(consts.HeaderXCache, "HIT")
+				writeCacheEntry(c, e, cacheControl)
+				c.Abort()
+				return
+			}
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// handler panic 時讓 Recover 可以直接寫入回應
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if !cacheable(w) {
+			w.flush()
+			return
+		}
+
+		e := cacheEntry{
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			ETag:        etag(w.buf.Bytes()),
+			Body:        w.buf.Bytes(),
+		}
+
+		if err := storeCacheEntry(ctx, client, key, p.TTL, cacheTags(c, p.Tags), e); err != nil {
+			zap.L().Warn("cache store error: "+err.Error(), zap.String("key", key))
+		}
+
+		h.Set(consts.HeaderXCache, "MISS")
+		writeCacheEntry(c, e, cacheControl)
+	}
+}
+
+// NoCache 讓之後的 Cache 不使用快取，並告知 client 不可以保存回應，用在 private group 等需要驗證的路由
+//
+// example:
+//
+//	privateGroup.Use(middleware.NoCache())
+func NoCache() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(keyNoCache, true)
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// InvalidateCache 清除帶有 tags 的快取，用在寫入資料之後
+//
+// example:
+//
+//	err = middleware.InvalidateCache(ctx, rdb, "order:"+id, "order:list")
+func InvalidateCache(ctx *ctx.Context, client *redis.Client, tags ...string) (err error) {
+	for _, tag := range tags {
+		tagKey := cacheTagPrefix + tag
+
+		var keys []string
+		keys, err = client.SMembers(ctx.Context, tagKey).Result()
+		if err != nil {
+			err = catch.Wrap(err, syserrno.Redis, "invalidate cache error", fmt.Sprintf("execute SMEMBERS command error. err: %s, tag: %s", err.Error(), tag))
+			return
+		}
+
+		_, err = client.Del(ctx.Context, append(keys, tagKey)...).Result()
+		if err != nil {
+			err = catch.Wrap(err, syserrno.Redis, "invalidate cache error", fmt.Sprintf("execute DEL command error. err: %s, tag: %s", err.Error(), tag))
+			return
+		}
+	}
+
+	return
+}
+
+func cacheBypassed(c *gin.Context) bool {
+	return c.GetBool(keyNoCache) ||
+		c.Request.Header.Get(consts.HeaderAuthorization) != "" ||
+		c.GetString(consts.KeyUserID) != "" ||
+		c.GetString(consts.KeyCaller) != ""
+}
+
+// cacheKey 以路徑、排序後的 query 及 VaryHeaders 的值組成，過長的部分以 sha256 表示
+func cacheKey(c *gin.Context, p CachePolicy) string {
+	query := c.Request.URL.Query()
+	for _, name := range p.IgnoreQuery {
+		query.Del(name)
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+
+	var b strings.Builder
+	// Encode 會依照 key 排序
+	b.WriteString(query.Encode())
+	for _, name := range p.VaryHeaders {
+		b.WriteString("\n")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString(":")
+		b.WriteString(c.Request.Header.Get(name))
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return cacheKeyPrefix + c.Request.URL.Path + ":" + hex.EncodeToString(sum[:16])
+}
+
+// cacheTags 將 tag 中的 {param} 替換為路由參數
+func cacheTags(c *gin.Context, tags []string) (res []string) {
+	for _, tag := range tags {
+		for _, param := range c.Params {
+			tag = strings.ReplaceAll(tag, "{"+param.Key+"}", param.Value)
+		}
+		res = append(res, tag)
+	}
+	return
+}
+
+// cacheable 只保存成功的 response.Response
+func cacheable(w *bufferedWriter) bool {
+	if w.Status() != http.StatusOK || w.buf.Len() == 0 {
+		return false
+	}
+
+	var res response.Response
+	if err := json.Unmarshal(w.buf.Bytes(), &res); err != nil {
+		return false
+	}
+
+	return res.Status.Code == syserrno.OK
+}
+
+func storeCacheEntry(ctx *ctx.Context, client *redis.Client, key string, ttl time.Duration, tags []string, e cacheEntry) (err error) {
+	err = rdb.SetEX(ctx, client, key, ttl, e)
+	if err != nil || len(tags) == 0 {
+		return
+	}
+
+	_, err = client.Pipelined(ctx.Context, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			// 每次保存都會延長 tag 的期限，讓 tag 保存到最後一個快取過期
+			pipe.SAdd(ctx.Context, cacheTagPrefix+tag, key)
+			pipe.Expire(ctx.Context, cacheTagPrefix+tag, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		err = catch.Wrap(err, syserrno.Redis, "store cache tags error", fmt.Sprintf("store cache tags error. err: %s, tags: %v", err.Error(), tags))
+	}
+
+	return
+}
+
+func writeCacheEntry(c *gin.Context, e cacheEntry, cacheControl string) {
+	h := c.Writer.Header()
+	h.Set("ETag", e.ETag)
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", cacheControl)
+	}
+
+	if etagMatch(c.Request.Header.Get("If-None-Match"), e.ETag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	c.Data(e.Status, e.ContentType, e.Body)
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch 比對 If-None-Match，支援多個值、W/ 及 *
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter 暫存回應，讓 Cache 可以在 handler 結束後才決定標頭
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	buf     bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.buf.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+func (w *bufferedWriter) Flush() {}
+
+// flush 將暫存的回應寫入原本的 ResponseWriter
+func (w *bufferedWriter) flush() {
+	if !w.written && w.status == 0 {
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(w.Status())
+	if w.buf.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
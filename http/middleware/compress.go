@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+// CompressPolicy 回應壓縮的規則
+type CompressPolicy struct {
+	// MinSize 回應小於此大小（byte）時不壓縮
+	MinSize int
+	// ContentTypes 壓縮的類型，結尾為 "/" 時比對前綴，如 "text/"
+	ContentTypes []string
+	GzipLevel    int
+	BrotliLevel  int
+}
+
+func DefaultCompressPolicy() CompressPolicy {
+	return CompressPolicy{
+		MinSize: 1024,
+		ContentTypes: []string{
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"image/svg+xml",
+			"text/",
+		},
+		GzipLevel:   gzip.DefaultCompression,
+		BrotliLevel: 5,
+	}
+}
+
+func (p CompressPolicy) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range p.ContentTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress 依照 Accept-Encoding 以 brotli 或 gzip 壓縮回應，同時會解壓縮 Content-Encoding 為 gzip 的請求，
+// 無法解壓縮時回傳 400。需要限制解壓縮後的大小時 BodyLimit 要放在 Compress 之後
+//
+// example:
+//
+//	e.Use(middleware.Compress())
+func Compress(policy ...CompressPolicy) gin.HandlerFunc {
+	p := DefaultCompressPolicy()
+	if len(policy) > 0 {
+		p = policy[0]
+	}
+
+	gzipPool := sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, p.GzipLevel)
+		return w
+	}}
+	brotliPool := sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, p.BrotliLevel)
+	}}
+
+	return func(c *gin.Context) {
+		if strings.EqualFold(c.Request.Header.Get("Content-Encoding"), encodingGzip) && c.Request.Body != nil {
+			r, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				ctx := ctx.New(c, c.Request.Context())
+				response.Error(ctx, http.StatusBadRequest, catch.New(
+					syserrno.ValidParameter,
+					"invalid gzip request body",
+					fmt.Sprintf("decompress gzip request body error: %s", err.Error()),
+				))
+				c.Abort()
+				return
+			}
+			c.Request.Body = &gzipBody{Reader: r, body: c.Request.Body}
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.Header.Del("Content-Length")
+			c.Request.ContentLength = -1
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(c.Request.Header.Get("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, policy: p, encoding: encoding}
+		switch encoding {
+		case encodingBrotli:
+			w.pool = &brotliPool
+		default:
+			w.pool = &gzipPool
+		}
+		c.Writer = w
+		defer func() {
+			// handler panic 時讓 Recover 可以直接寫入回應
+			c.Writer = w.ResponseWriter
+			w.close()
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding 依照 Accept-Encoding 的 q 值選擇，相同時優先使用 brotli
+func negotiateEncoding(accept string) (res string) {
+	best := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encodingGzip && name != encodingBrotli {
+			continue
+		}
+
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > best || (q == best && q > 0 && name == encodingBrotli) {
+			best = q
+			res = name
+		}
+	}
+
+	if best == 0 {
+		return ""
+	}
+	return
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// compressWriter 先暫存 MinSize 的回應，超過時才決定是否壓縮
+type compressWriter struct {
+	gin.ResponseWriter
+	policy   CompressPolicy
+	encoding string
+	pool     *sync.Pool
+
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+// resettable gzip.Writer 及 brotli.Writer 共用的介面
+type resettable interface {
+	io.WriteCloser
+	Reset(io.Writer)
+	Flush() error
+}
+
+func (w *compressWriter) decide() {
+	w.decided = true
+
+	h := w.Header()
+	status := w.ResponseWriter.Status()
+	if len(w.buf) < w.policy.MinSize ||
+		h.Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified ||
+		!w.policy.compressible(h.Get("Content-Type")) {
+		return
+	}
+
+	enc := w.pool.Get().(resettable)
+	enc.Reset(w.ResponseWriter)
+	w.enc = enc
+
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	// 壓縮後內容不同，strong ETag 需要改為 weak
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.policy.MinSize {
+			return len(b), nil
+		}
+		w.decide()
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 還沒決定是否壓縮前不能送出標頭
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+		w.flushBuffer()
+	}
+	if enc, ok := w.enc.(resettable); ok {
+		enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) flushBuffer() (err error) {
+	if len(w.buf) == 0 {
+		return
+	}
+
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide()
+		w.flushBuffer()
+	}
+
+	// 沒有壓縮時標頭由 gin 在請求結束時送出
+	if w.enc == nil {
+		return
+	}
+
+	w.enc.Close()
+	enc := w.enc.(resettable)
+	enc.Reset(io.Discard)
+	w.pool.Put(enc)
+}
@@ -1,20 +1,317 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/consts"
+	"go.uber.org/zap"
+)
+
+// CORSConsulPath CORS() 沒有傳入 policy 時載入的 consul 路徑
+const CORSConsulPath = "/system/cors"
+
+// CORSPolicy 跨來源請求的規則
+type CORSPolicy struct {
+	// AllowOrigins 允許的來源，支援：
+	//   - 完整比對："https://app.example.com"
+	//   - 子網域："https://*.example.com"（不包含 https://example.com）
+	//   - 正規表示式：以 "re:" 開頭，需要符合完整的來源，如 "re:https://pr-\d+\.preview\.example\.com"
+	//   - "*"：允許所有來源，此時不會回傳 Access-Control-Allow-Credentials
+	//
+	// 比對時來源會先轉為小寫
+	AllowOrigins []string
+	// AllowMethods, AllowHeaders 包含 "*" 時允許 preflight 要求的所有方法或標頭
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	// MaxAge preflight 的快取時間
+	MaxAge time.Duration
+}
+
+// DefaultCORSPolicy 不允許任何來源，方法、標頭及 MaxAge 為一般服務使用的預設值
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowHeaders: []string{
+			"Content-Type",
+			consts.HeaderAuthorization,
+			consts.HeaderLang,
+			consts.HeaderAcceptLanguage,
+			consts.HeaderXRequestId,
+			consts.HeaderIdempotencyKey,
+		},
+		ExposeHeaders: []string{
+			consts.HeaderXRequestId,
+			consts.HeaderRetryAfter,
+			consts.HeaderRateLimitLimit,
+			consts.HeaderRateLimitRemaining,
+			consts.HeaderRateLimitReset,
+		},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// LegacyCORSPolicy 允許所有來源、方法及標頭，但不回傳 Access-Control-Allow-Credentials，與舊版 CORS() 的行為相同，
+// 移轉期間需要時明確傳入 CORS(middleware.LegacyCORSPolicy())，之後的版本會移除
+func LegacyCORSPolicy() CORSPolicy {
+	p := DefaultCORSPolicy()
+	p.AllowOrigins = []string{"*"}
+	p.AllowMethods = []string{"*"}
+	p.AllowHeaders = []string{"*"}
+	return p
+}
+
+// GetCORSPolicy 從 consul 載入 CORSPolicy，與 basic.Site 同名的區塊會覆寫最上層的設定，沒有設定的欄位使用 DefaultCORSPolicy
+//
+// 假設 consul 路徑 "/system/cors" 內有下列資料
+// `
+//
+//	allow_origins = ["https://app.example.com", "https://*.example.com"]
+//	allow_credentials = true
+//	max_age = "10m"
+//	[dev]
+//	allow_origins = ["http://localhost:3000", "re:^https://pr-\\d{1,5}\\.preview\\.example\\.com$"]
+//
+// `
+//
+// allow_origins、allow_methods、allow_headers、expose_headers 為 TOML 陣列，也接受以逗號分隔的字串，
+// 但正規表示式可能包含逗號（如 {1,3}），請使用陣列
+func GetCORSPolicy(path string) (p CORSPolicy) {
+	p = DefaultCORSPolicy()
+
+	v, err := config.GetValues(path, false)
+	if err != nil {
+		return
+	}
+	v = v.Override(basic.Site)
+
+	if v.Has("allow_origins") {
+		p.AllowOrigins = append([]string{}, v.Strings("allow_origins")...)
+	}
+	if v.Has("allow_methods") {
+		p.AllowMethods = v.Strings("allow_methods")
+	}
+	if v.Has("allow_headers") {
+		p.AllowHeaders = v.Strings("allow_headers")
+	}
+	if v.Has("expose_headers") {
+		p.ExposeHeaders = v.Strings("expose_headers")
+	}
+	if v.Has("allow_credentials") {
+		p.AllowCredentials = v.Bool("allow_credentials")
+	}
+	if d, ok := v.Duration("max_age"); ok {
+		p.MaxAge = d
+	}
+
+	return
+}
+
+// CORS 依照 policy 處理跨來源請求，沒有傳入 policy 時從 CORSConsulPath 載入，
+// consul 沒有設定 allow_origins 時與 DefaultCORSPolicy 相同不允許任何來源，並記錄 warn。
+// 不允許的來源不會帶上任何 CORS 標頭，preflight 會回傳 403，兩者都會記錄 log
+func CORS(policy ...CORSPolicy) gin.HandlerFunc {
+	var p CORSPolicy
+	if len(policy) > 0 {
+		p = policy[0]
+	} else {
+		p = GetCORSPolicy(CORSConsulPath)
+		if p.AllowOrigins == nil {
+			zap.L().Warn(fmt.Sprintf("cors: allow_origins is not set in %s, no cross-origin requests are allowed", CORSConsulPath))
+		}
+	}
+
+	m := newOriginMatcher(p.AllowOrigins)
+	if m.any && p.AllowCredentials {
+		zap.L().Warn("cors: allow credentials is ignored when allow origins contains `*`")
+	}
+
+	allowMethods := strings.Join(p.AllowMethods, ", ")
+	exposeHeaders := strings.Join(p.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(p.MaxAge.Seconds()))
+	allowHeaders := map[string]bool{}
+	for _, h := range p.AllowHeaders {
+		allowHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	anyMethod := containsFold(p.AllowMethods, "*")
 
-func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
 
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "*")
-		c.Header("Access-Control-Allow-Methods", "*")
+		h := c.Writer.Header()
+		if !m.any {
+			// 回應會因 Origin 不同而不同，避免被 cache 共用
+			h.Add("Vary", "Origin")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if origin == "" {
+			c.Next()
 			return
 		}
 
-		c.Next()
+		if !m.match(origin) {
+			zap.L().Warn("cors: origin not allowed",
+				zap.String("origin", origin),
+				zap.String("method", c.Request.Method),
+				zap.String("uri", c.Request.RequestURI),
+				zap.String("clientIP", c.ClientIP()),
+			)
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if m.any {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if p.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		method := c.Request.Header.Get("Access-Control-Request-Method")
+		if !anyMethod && !containsFold(p.AllowMethods, method) {
+			rejectPreflight(c, origin, fmt.Sprintf("method %s not allowed", method))
+			return
+		}
+
+		requested := splitHeaderValues(c.Request.Header.Get("Access-Control-Request-Headers"))
+		for _, name := range requested {
+			if !allowHeaders["*"] && !allowHeaders[http.CanonicalHeaderKey(name)] {
+				rejectPreflight(c, origin, fmt.Sprintf("header %s not allowed", name))
+				return
+			}
+		}
+
+		if anyMethod {
+			h.Set("Access-Control-Allow-Methods", method)
+		} else {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+		}
+		if len(requested) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if p.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func rejectPreflight(c *gin.Context, origin, reason string) {
+	zap.L().Warn("cors: preflight rejected, "+reason,
+		zap.String("origin", origin),
+		zap.String("uri", c.Request.RequestURI),
+		zap.String("clientIP", c.ClientIP()),
+	)
+	c.Writer.Header().Del("Access-Control-Allow-Origin")
+	c.Writer.Header().Del("Access-Control-Allow-Credentials")
+	c.AbortWithStatus(http.StatusForbidden)
+}
+
+type originMatcher struct {
+	any      bool
+	exact    map[string]bool
+	wildcard [][2]string
+	regexps  []*regexp.Regexp
+}
+
+func newOriginMatcher(origins []string) (m *originMatcher) {
+	m = &originMatcher{exact: map[string]bool{}}
+
+	for _, o := range origins {
+		switch {
+		case o == "*":
+			m.any = true
+		case strings.HasPrefix(o, "re:"):
+			// 錨定整個來源，避免 "https://app\.example\.com" 也符合 "https://app.example.com.evil.io"
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(o, "re:") + ")$")
+			if err != nil {
+				zap.L().Warn(fmt.Sprintf("cors: ignore invalid origin pattern `%s`: %s", o, err.Error()))
+				continue
+			}
+			m.regexps = append(m.regexps, re)
+		case strings.Contains(o, "*"):
+			prefix, suffix, _ := strings.Cut(strings.ToLower(o), "*")
+			m.wildcard = append(m.wildcard, [2]string{prefix, suffix})
+		default:
+			m.exact[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+		}
+	}
+
+	return
+}
+
+func (m *originMatcher) match(origin string) bool {
+	if m.any {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if m.exact[origin] {
+		return true
+	}
+
+	for _, w := range m.wildcard {
+		if len(origin) > len(w[0])+len(w[1]) && strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+			// 萬用字元只能對應到子網域，不能跨越 scheme、port 或路徑
+			sub := origin[len(w[0]) : len(origin)-len(w[1])]
+			if !strings.ContainsAny(sub, "/:@") {
+				return true
+			}
+		}
+	}
+
+	for _, re := range m.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitHeaderValues 拆開以逗號分隔的標頭值（如 Access-Control-Request-Headers），去除前後空白並略過空值
+func splitHeaderValues(s string) (res []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
 	}
+	return false
 }
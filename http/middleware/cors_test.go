@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Test_originMatcher(t *testing.T) {
+	m := newOriginMatcher([]string{
+		"https://app.example.com/",
+		"https://*.example.com",
+		`re:https://pr-\d+\.preview\.example\.io`,
+		`re:^https://admin\.example\.io$`,
+	})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://app.example.com", want: true},
+		{origin: "HTTPS://APP.EXAMPLE.COM", want: true},
+		{origin: "https://a.example.com", want: true},
+		{origin: "https://example.com", want: false},
+		{origin: "https://a.example.com:8443", want: false},
+		{origin: "https://pr-12.preview.example.io", want: true},
+		{origin: "https://pr-12.preview.example.io.evil.com", want: false},
+		{origin: "https://evil.com?https://pr-12.preview.example.io", want: false},
+		{origin: "https://admin.example.io", want: true},
+		{origin: "https://evil.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := m.match(tt.origin); got != tt.want {
+				t.Errorf("match(%s) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	allowed := DefaultCORSPolicy()
+	allowed.AllowOrigins = []string{"https://app.example.com"}
+
+	tests := []struct {
+		name       string
+		policy     CORSPolicy
+		method     string
+		header     map[string]string
+		wantStatus int
+		wantOrigin string
+		wantAllow  string
+	}{
+		{
+			name:       "default policy denies",
+			policy:     DefaultCORSPolicy(),
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "default policy rejects preflight",
+			policy:     DefaultCORSPolicy(),
+			method:     http.MethodOptions,
+			header:     map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": http.MethodPost},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "allowed origin",
+			policy:     allowed,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:   "allowed preflight",
+			policy: allowed,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": " content-type, ,Idempotency-Key ",
+			},
+			wantStatus: http.StatusNoContent,
+			wantOrigin: "https://app.example.com",
+			wantAllow:  "content-type, Idempotency-Key",
+		},
+		{
+			name:   "preflight with header not allowed",
+			policy: allowed,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "X-Custom",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := gin.New()
+			e.Use(CORS(tt.policy))
+			e.Handle(tt.method, "/a", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/a", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/storage/rdb"
+	"github.com/win30221/core/syserrno"
+	"go.uber.org/zap"
+)
+
+// IdempotencyPolicy Idempotency 的設定
+type IdempotencyPolicy struct {
+	// TTL 保存回應的時間，期間內相同的 Idempotency-Key 會重送保存的回應
+	TTL time.Duration
+	// LockTTL 處理中的鎖的時間，應大於請求的處理時間上限（參考 Timeout）
+	LockTTL time.Duration
+	// Required 為 true 時沒有 Idempotency-Key 的請求回傳 400
+	Required bool
+	// MaxKeyLength Idempotency-Key 的長度上限
+	MaxKeyLength int
+	// MaxBodySize 計算 fingerprint 時讀入記憶體的 body 大小上限（byte），超過時回傳 413
+	MaxBodySize int64
+}
+
+func DefaultIdempotencyPolicy() IdempotencyPolicy {
+	return IdempotencyPolicy{
+		TTL:          24 * time.Hour,
+		LockTTL:      time.Minute,
+		MaxKeyLength: 255,
+		MaxBodySize:  1 << 20,
+	}
+}
+
+const (
+	idempotencyProcessing = "processing"
+	idempotencyDone       = "done"
+)
+
+// idempotencyRecord 保存在 redis 中的處理狀態及回應
+type idempotencyRecord struct {
+	State       string `json:"state"`
+	Fingerprint string `json:"fingerprint"`
+	// Token 上鎖的請求各自產生，釋放鎖或保存回應前確認鎖仍屬於目前的請求
+	Token  string      `json:"token,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Idempotency 依照 Idempotency-Key 確保 POST、PUT、PATCH、DELETE 只會被處理一次：
+//   - 第一次請求會在 redis 中上鎖，處理完成後保存回應（status、header、body）TTL 的時間
+//   - 相同 key 且內容相同（method、路徑、query 及 body）的請求直接重送保存的回應，並帶上 Idempotent-Replayed
+//   - 相同 key 的請求還在處理中時回傳 409 及 syserrno.IdempotencyInProgress
+//   - 相同 key 但內容不同時回傳 409 及 syserrno.IdempotencyKeyReused
+//
+// 回應為 5xx 或 handler panic 時不會保存，會釋放鎖讓呼叫端重試。
+// 處理時間超過 LockTTL 時鎖可能已被相同 key 的請求取得，此時不會釋放鎖也不會保存回應，以免覆寫後來的請求。
+// key 會依照 JWT 的使用者或簽章驗證的呼叫端區分，所以需要放在 JWT 或 VerifySignature 之後。
+// 計算 fingerprint 時會將 body 完整讀入記憶體，最多 MaxBodySize，有使用 BodyLimit 時要放在 BodyLimit 之後。
+// 保存的是壓縮前的回應，有使用 Compress 時要放在 Compress 之後。
+// redis 發生錯誤時放行並記錄 log
+//
+// example:
+//
+//	privateGroup.POST("/order", middleware.Idempotency(storage.GetRedis("/storage/redis", "order")), delivery.CreateOrder)
+func Idempotency(client *redis.Client, policy ...IdempotencyPolicy) gin.HandlerFunc {
+	p := DefaultIdempotencyPolicy()
+	if len(policy) > 0 {
+		p = policy[0]
+	}
+
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		ctx := ctx.New(c, c.Request.Context())
+
+		key := c.Request.Header.Get(consts.HeaderIdempotencyKey)
+		switch {
+		case key == "" && p.Required:
+			response.Error(ctx, http.StatusBadRequest, catch.New(syserrno.ValidParameter, "missing idempotency key", "missing idempotency key"))
+			c.Abort()
+			return
+		case key == "":
+			c.Next()
+			return
+		case p.MaxKeyLength > 0 && len(key) > p.MaxKeyLength:
+			response.Error(ctx, http.StatusBadRequest, catch.New(
+				syserrno.ValidParameter,
+				"invalid idempotency key",
+				fmt.Sprintf("idempotency key is longer than %d", p.MaxKeyLength),
+			))
+			c.Abort()
+			return
+		}
+
+		fingerprint, err := requestFingerprint(c, p.MaxBodySize)
+		if errors.Is(err, errBodyTooLarge) {
+			c.Set(consts.KeyBodyTooLarge, true)
+			response.Error(ctx, http.StatusRequestEntityTooLarge, bodyTooLargeError(p.MaxBodySize))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			response.Error(ctx, http.StatusBadRequest, catch.New(
+				syserrno.ValidParameter,
+				"read request body error",
+				fmt.Sprintf("read request body error: %s", err.Error()),
+			))
+			c.Abort()
+			return
+		}
+
+		redisKey := idempotencyKey(c, key)
+
+		token, err := idempotencyToken()
+		if err != nil {
+			zap.L().Warn("idempotency generate token error: "+err.Error(), zap.String("key", redisKey))
+			c.Next()
+			return
+		}
+
+		err = rdb.SetNX(ctx, client, redisKey, p.LockTTL, idempotencyRecord{State: idempotencyProcessing, Fingerprint: fingerprint, Token: token})
+		if err != nil {
+			// 上鎖失敗可能是 key 已存在或 redis 錯誤，讀取後才能分辨
+			var rec idempotencyRecord
+			if err = rdb.Get(ctx, client, redisKey, &rec); err != nil {
+				zap.L().Warn("idempotency store error: "+err.Error(), zap.String("key", redisKey))
+				c.Next()
+				return
+			}
+
+			replayIdempotent(c, ctx, key, fingerprint, rec)
+			return
+		}
+
+		// 請求被取消或逾時後仍需要保存結果或釋放鎖
+		detached := ctx.WithContext(context.WithoutCancel(ctx))
+
+		w := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			released, err := idempotencyRelease.Run(detached, client, []string{redisKey}, token).Bool()
+			if err != nil {
+				zap.L().Warn("idempotency release lock error: "+err.Error(), zap.String("key", redisKey))
+				return
+			}
+			if !released {
+				zap.L().Warn("idempotency lock expired before the request finished, increase LockTTL", zap.String("key", redisKey))
+			}
+		}()
+
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		rec := idempotencyRecord{
+			State:       idempotencyDone,
+			Fingerprint: fingerprint,
+			Status:      w.Status(),
+			Header:      storedHeader(w.Header()),
+			Body:        w.buf.Bytes(),
+		}
+
+		b, err := json.Marshal(rec)
+		if err != nil {
+			zap.L().Warn("idempotency marshal response error: "+err.Error(), zap.String("key", redisKey))
+			return
+		}
+
+		saved, err := idempotencyStore.Run(detached, client, []string{redisKey}, token, b, p.TTL.Milliseconds()).Bool()
+		if err != nil {
+			zap.L().Warn("idempotency save response error: "+err.Error(), zap.String("key", redisKey))
+			return
+		}
+		if !saved {
+			zap.L().Warn("idempotency lock expired before the request finished, the response is not saved, increase LockTTL", zap.String("key", redisKey))
+		}
+		// 沒有保存時鎖已經不屬於目前的請求，也不需要再釋放
+		stored = true
+	}
+}
+
+// idempotencyRelease 鎖仍屬於 ARGV[1] 的請求時才刪除，回傳是否刪除
+var idempotencyRelease = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).token == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// idempotencyStore 鎖仍屬於 ARGV[1] 的請求時才以 ARGV[2] 覆寫，ARGV[3] 為保存的毫秒數，回傳是否保存
+var idempotencyStore = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).token == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+func idempotencyToken() (res string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	res = hex.EncodeToString(b)
+	return
+}
+
+// storedHeader 保存的 body 是壓縮前的內容，重送時由 Compress 重新決定編碼，
+// 所以不保存 Content-Encoding、Content-Length 及 Vary
+func storedHeader(header http.Header) (res http.Header) {
+	res = header.Clone()
+	res.Del("Content-Encoding")
+	res.Del("Content-Length")
+	res.Del("Vary")
+	return
+}
+
+func replayIdempotent(c *gin.Context, ctx *ctx.Context, key, fingerprint string, rec idempotencyRecord) {
+	switch {
+	case rec.Fingerprint != "" && rec.Fingerprint != fingerprint:
+		response.Error(ctx, http.StatusConflict, catch.New(
+			syserrno.IdempotencyKeyReused,
+			"idempotency key was used with a different request",
+			fmt.Sprintf("idempotency key `%s` was used with a different request", key),
+		))
+		c.Abort()
+	case rec.State != idempotencyDone:
+		// 處理中，或鎖剛好在讀取前被釋放
+		c.Header(consts.HeaderRetryAfter, "1")
+		response.Error(ctx, http.StatusConflict, catch.New(
+			syserrno.IdempotencyInProgress,
+			"a request with the same idempotency key is in progress",
+			fmt.Sprintf("idempotency key `%s` is in progress", key),
+		))
+		c.Abort()
+	default:
+		// 目前的 middleware 已經設定的標頭（如 RateLimit-*）不會被覆寫
+		h := c.Writer.Header()
+		for k, v := range rec.Header {
+			if _, ok := h[k]; !ok {
+				h[k] = v
+			}
+		}
+		h.Set(consts.HeaderIdempotentReplayed, "true")
+		c.Data(rec.Status, rec.Header.Get("Content-Type"), rec.Body)
+		c.Abort()
+	}
+}
+
+// idempotencyKey 依照使用者或呼叫端區分 key，避免不同的使用者使用相同的 key
+func idempotencyKey(c *gin.Context, key string) string {
+	scope := "anonymous"
+	if id := c.GetString(consts.KeyUserID); id != "" {
+		scope = "user:" + id
+	} else if caller := c.GetString(consts.KeyCaller); caller != "" {
+		scope = "caller:" + caller
+	}
+
+	return fmt.Sprintf("idempotency:%s:%s:%s", c.FullPath(), scope, key)
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// requestFingerprint 計算 method、路徑、query 及 body 的 sha256，讀取後會還原 body，
+// body 超過 maxBodySize 時回傳 errBodyTooLarge，maxBodySize 為 0 時不限制
+func requestFingerprint(c *gin.Context, maxBodySize int64) (res string, err error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", c.Request.Method, c.Request.URL.RequestURI())
+
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		var r io.Reader = c.Request.Body
+		if maxBodySize > 0 {
+			r = io.LimitReader(r, maxBodySize+1)
+		}
+
+		var b []byte
+		b, err = io.ReadAll(r)
+		c.Request.Body.Close()
+		if err != nil {
+			return
+		}
+		if maxBodySize > 0 && int64(len(b)) > maxBodySize {
+			err = errBodyTooLarge
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(b))
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyWriter 保存完整的回應 body
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/http/consts"
+)
+
+// fakeRedis 以 hook 攔截指令的記憶體版 redis，只實作 Idempotency 用到的指令，不會建立連線
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newFakeRedis() (*redis.Client, *fakeRedis) {
+	f := &fakeRedis{data: map[string]string{}}
+	client := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	client.AddHook(f)
+	return client, f
+}
+
+func (f *fakeRedis) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (f *fakeRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (f *fakeRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		args := cmd.Args()
+		key, _ := args[1].(string)
+		switch cmd.Name() {
+		case "set":
+			nx := false
+			for _, a := range args[3:] {
+				if s, ok := a.(string); ok && strings.EqualFold(s, "nx") {
+					nx = true
+				}
+			}
+			if _, ok := f.data[key]; ok && nx {
+				cmd.(*redis.BoolCmd).SetVal(false)
+				return nil
+			}
+			f.data[key] = toString(args[2])
+			switch cmd := cmd.(type) {
+			case *redis.BoolCmd:
+				cmd.SetVal(true)
+			case *redis.StatusCmd:
+				cmd.SetVal("OK")
+			}
+		case "get":
+			v, ok := f.data[key]
+			if !ok {
+				cmd.SetErr(redis.Nil)
+				return redis.Nil
+			}
+			cmd.(*redis.StringCmd).SetVal(v)
+		case "del":
+			_, ok := f.data[key]
+			delete(f.data, key)
+			n := int64(0)
+			if ok {
+				n = 1
+			}
+			cmd.(*redis.IntCmd).SetVal(n)
+		case "evalsha":
+			// 以 Go 模擬 idempotencyRelease、idempotencyStore
+			key = args[3].(string)
+			token := args[4].(string)
+			var rec idempotencyRecord
+			v, ok := f.data[key]
+			owned := ok && json.Unmarshal([]byte(v), &rec) == nil && rec.Token == token
+
+			res := int64(0)
+			if owned {
+				res = 1
+				switch args[1] {
+				case idempotencyRelease.Hash():
+					delete(f.data, key)
+				case idempotencyStore.Hash():
+					f.data[key] = toString(args[5])
+				}
+			}
+			cmd.(*redis.Cmd).SetVal(res)
+		default:
+			cmd.SetErr(redis.ErrClosed)
+			return redis.ErrClosed
+		}
+		return nil
+	}
+}
+
+func (f *fakeRedis) get(key string) (rec idempotencyRecord, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.data[key]
+	if ok {
+		json.Unmarshal([]byte(v), &rec)
+	}
+	return
+}
+
+func (f *fakeRedis) set(key string, rec idempotencyRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, _ := json.Marshal(rec)
+	f.data[key] = string(b)
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func TestIdempotency_replayThroughCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	basic.TimeZone = time.UTC
+
+	client, _ := newFakeRedis()
+	body := strings.Repeat("a", 2048)
+	calls := 0
+
+	e := gin.New()
+	e.Use(Compress())
+	e.POST("/order", Idempotency(client), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"data": body})
+	})
+
+	do := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(`{"id":1}`))
+		req.Header.Set(consts.HeaderIdempotencyKey, "k1")
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) string {
+		if w.Header().Get("Content-Encoding") != encodingGzip {
+			return w.Body.String()
+		}
+		r, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("gzip reader error: %v", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read gzip body error: %v", err)
+		}
+		return string(b)
+	}
+
+	first := do(encodingGzip)
+	if first.Header().Get("Content-Encoding") != encodingGzip {
+		t.Fatalf("first response header = %v, want gzip", first.Header())
+	}
+	want := decode(first)
+
+	replayed := do(encodingGzip)
+	if replayed.Header().Get(consts.HeaderIdempotentReplayed) != "true" || decode(replayed) != want {
+		t.Errorf("gzip replay = %v, body does not match the first response", replayed.Header())
+	}
+
+	plain := do("")
+	if plain.Header().Get("Content-Encoding") != "" || plain.Body.String() != want {
+		t.Errorf("plain replay = %v %q, want the uncompressed body", plain.Header(), plain.Body.String())
+	}
+	if vary := plain.Header().Values("Vary"); len(vary) != 1 {
+		t.Errorf("plain replay Vary = %v, want a single Accept-Encoding", vary)
+	}
+
+	if calls != 1 {
+		t.Errorf("handler calls = %d, want 1", calls)
+	}
+}
+
+// 處理時間超過 LockTTL 後鎖被相同 key 的請求取得時，不能釋放或覆寫後來的請求的鎖
+func TestIdempotency_lockExpired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	basic.TimeZone = time.UTC
+
+	const redisKey = "idempotency:/order:anonymous:k1"
+	other := idempotencyRecord{State: idempotencyProcessing, Fingerprint: "other", Token: "other-token"}
+
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			client, f := newFakeRedis()
+
+			e := gin.New()
+			e.POST("/order", Idempotency(client), func(c *gin.Context) {
+				// 模擬鎖過期後被相同 key 的請求取得
+				f.set(redisKey, other)
+				c.Status(status)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/order", nil)
+			req.Header.Set(consts.HeaderIdempotencyKey, "k1")
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if rec, ok := f.get(redisKey); !ok || rec.Token != other.Token || rec.State != idempotencyProcessing {
+				t.Errorf("record = %+v, %v, want the lock of the other request", rec, ok)
+			}
+		})
+	}
+
+	// 鎖仍屬於目前的請求時正常保存及釋放
+	client, f := newFakeRedis()
+	e := gin.New()
+	e.POST("/order", Idempotency(client), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	e.POST("/fail", Idempotency(client), func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/order", "/fail"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(consts.HeaderIdempotencyKey, "k1")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if rec, ok := f.get(redisKey); !ok || rec.State != idempotencyDone || rec.Status != http.StatusOK {
+		t.Errorf("record = %+v, %v, want the saved response", rec, ok)
+	}
+	if _, ok := f.get("idempotency:/fail:anonymous:k1"); ok {
+		t.Error("lock of the failed request is not released")
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/jwt"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+// JWT 驗證 Authorization 標頭的 Bearer token，通過後可以從 ctx.Context 的 UserID()、Claims() 取得使用者資訊
+//
+// example:
+//
+//	publicGroup.Use(middleware.JWT(jwt.GetVerifier("/system/jwt")))
+func JWT(v *jwt.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := verifyBearer(v, c.Request.Header.Get(consts.HeaderAuthorization))
+		if err != nil {
+			ctx := ctx.New(c, c.Request.Context())
+			response.Error(ctx, http.StatusUnauthorized, catch.Wrap(
+				err,
+				syserrno.InvalidToken,
+				"invalid token",
+				fmt.Sprintf("verify jwt error: %s, remote: %s, uri: %s", err.Error(), c.ClientIP(), c.Request.RequestURI),
+			))
+			c.Abort()
+			return
+		}
+
+		c.Set(consts.KeyClaims, claims)
+		c.Set(consts.KeyUserID, claimString(claims, v.UserIDClaim))
+		c.Next()
+	}
+}
+
+func verifyBearer(v *jwt.Verifier, authorization string) (claims jwt.Claims, err error) {
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		err = errors.New("missing bearer token")
+		return
+	}
+
+	return v.Verify(strings.TrimSpace(token))
+}
+
+// claimString 數字型別的 user id 也轉為字串
+func claimString(claims jwt.Claims, key string) string {
+	if key == "" {
+		key = "sub"
+	}
+
+	switch v := claims[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/i18n"
+)
+
+// LangMiddleware 依照 Lang 與 Accept-Language 決定 request 的語系，保存在 consts.KeyLang 給 ctx.New 使用，不會修改 request
+func LangMiddleware(c *gin.Context) {
+	req := c.Request
+	c.Set(consts.KeyLang, i18n.Resolve(req.Header.Get(consts.HeaderLang), req.Header.Get(consts.HeaderAcceptLanguage)))
+	c.Next()
+}
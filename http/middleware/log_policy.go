@@ -0,0 +1,379 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/consts"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const redacted = "[REDACTED]"
+
+// LogPolicy access log 的輸出規則
+type LogPolicy struct {
+	// ExcludePaths 不輸出 log 的路由，可以是 gin 的 FullPath 或請求路徑的結尾
+	ExcludePaths []string
+	// Headers 輸出的標頭，SensitiveHeaders 中的標頭只會輸出遮蔽後的值
+	Headers []string
+	// RequestBody, ResponseBody 是否記錄 body，只記錄 BodyContentTypes 中的類型且最多 BodyLimit 個 byte
+	RequestBody      bool
+	ResponseBody     bool
+	BodyLimit        int
+	BodyContentTypes []string
+	// RedactFields form、JSON body 及 result 中名稱包含這些字（不分大小寫，忽略 _ 及 -）的欄位會被遮蔽。
+	// 以子字串比對，如 token 也會遮蔽 accessToken、tokenCount；以 = 開頭時只比對完整的名稱，如 =id 只會遮蔽 id、ID
+	RedactFields []string
+	// RedactCardNumbers 遮蔽所有字串中看起來像信用卡號的數字（Luhn 檢查），只保留末 4 碼
+	RedactCardNumbers bool
+	// Latency 超過時以 warn 輸出，RouteLatency 可以針對 "METHOD /path" 設定不同的值
+	Latency      time.Duration
+	RouteLatency map[string]time.Duration
+}
+
+// SensitiveHeaders 不論 LogPolicy 如何設定都會被遮蔽的標頭
+var SensitiveHeaders = []string{
+	consts.HeaderSysToken,
+	consts.HeaderAuthorization,
+	consts.HeaderXSignature,
+	"Cookie",
+	"Set-Cookie",
+	"Proxy-Authorization",
+}
+
+func DefaultLogPolicy() LogPolicy {
+	return LogPolicy{
+		ExcludePaths: []string{"/version", "/ping"},
+		Headers: []string{
+			consts.HeaderSysToken,
+			consts.HeaderAuthorization,
+			consts.HeaderXService,
+			consts.HeaderLang,
+			"Content-Type",
+			"User-Agent",
+		},
+		BodyLimit:         4096,
+		BodyContentTypes:  []string{"application/json", "application/x-www-form-urlencoded", "text/plain"},
+		RedactFields:      []string{"password", "passwd", "secret", "token", "apikey", "cardnumber", "cardno", "cvv", "cvc"},
+		RedactCardNumbers: true,
+		Latency:           time.Duration(basic.RequestLatencyThrottle) * time.Millisecond,
+	}
+}
+
+// GetLogPolicy 從 consul 載入 LogPolicy，沒有設定的欄位使用 DefaultLogPolicy
+//
+// 假設 consul 路徑 "/service/order/access_log" 內有下列資料
+// `
+//
+//	exclude_paths = "/version,/ping,/metrics"
+//	headers = "Authorization,Content-Type,User-Agent"
+//	request_body = true
+//	response_body = false
+//	body_limit = 4096
+//	body_content_types = "application/json,application/x-www-form-urlencoded"
+//	redact_fields = "password,token,cardNumber,=idNumber"
+//	redact_card_numbers = true
+//	latency = "1s"
+//	[route_latency]
+//	"GET /order/report" = "5s"
+//
+// `
+func GetLogPolicy(path string) (p LogPolicy) {
+	v, _ := config.GetValues(path, false)
+	return logPolicyFrom(v)
+}
+
+func logPolicyFrom(v config.Values) (p LogPolicy) {
+	p = DefaultLogPolicy()
+
+	if v.Has("exclude_paths") {
+		p.ExcludePaths = v.Strings("exclude_paths")
+	}
+	if v.Has("headers") {
+		p.Headers = v.Strings("headers")
+	}
+	if v.Has("request_body") {
+		p.RequestBody = v.Bool("request_body")
+	}
+	if v.Has("response_body") {
+		p.ResponseBody = v.Bool("response_body")
+	}
+	if v.Has("body_limit") {
+		p.BodyLimit = v.Int("body_limit")
+	}
+	if v.Has("body_content_types") {
+		p.BodyContentTypes = v.Strings("body_content_types")
+	}
+	if v.Has("redact_fields") {
+		p.RedactFields = v.Strings("redact_fields")
+	}
+	if v.Has("redact_card_numbers") {
+		p.RedactCardNumbers = v.Bool("redact_card_numbers")
+	}
+	if d, ok := v.Duration("latency"); ok {
+		p.Latency = d
+	}
+
+	routes := v.Section("route_latency")
+	for route := range routes {
+		// route example: get /order/report
+		d, ok := routes.Duration(route)
+		if !ok {
+			continue
+		}
+		if p.RouteLatency == nil {
+			p.RouteLatency = map[string]time.Duration{}
+		}
+		method, path, _ := strings.Cut(route, " ")
+		p.RouteLatency[strings.ToUpper(method)+" "+path] = d
+	}
+
+	return
+}
+
+func (p LogPolicy) excluded(fullPath, path string) bool {
+	for _, e := range p.ExcludePaths {
+		if fullPath == e || strings.HasSuffix(path, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// latency RouteLatency 的 key 不分大小寫（consul 的 key 會被轉為小寫）
+func (p LogPolicy) latency(method, fullPath string) time.Duration {
+	route := method + " " + fullPath
+	for k, d := range p.RouteLatency {
+		if strings.EqualFold(k, route) {
+			return d
+		}
+	}
+	return p.Latency
+}
+
+func (p LogPolicy) captureContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range p.BodyContentTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor 遮蔽 log 中的敏感資料
+type redactor struct {
+	// fields 以子字串比對，exact 比對完整的名稱
+	fields      []string
+	exact       map[string]bool
+	cardNumbers bool
+}
+
+func newRedactor(p LogPolicy) *redactor {
+	r := &redactor{exact: map[string]bool{}, cardNumbers: p.RedactCardNumbers}
+	for _, f := range p.RedactFields {
+		name, exact := strings.CutPrefix(f, "=")
+		if name = normalizeField(name); name == "" {
+			continue
+		}
+
+		if exact {
+			r.exact[name] = true
+		} else {
+			r.fields = append(r.fields, name)
+		}
+	}
+	return r
+}
+
+func normalizeField(s string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(s))
+}
+
+func (r *redactor) sensitive(key string) bool {
+	key = normalizeField(key)
+	if r.exact[key] {
+		return true
+	}
+	for _, f := range r.fields {
+		if strings.Contains(key, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// header 只輸出 allow 中的標頭，SensitiveHeaders 只保留 scheme（如 Bearer）
+func (r *redactor) header(h http.Header, allow []string) (res map[string][]string) {
+	res = map[string][]string{}
+	for _, name := range allow {
+		name = http.CanonicalHeaderKey(name)
+		values, ok := h[name]
+		if !ok {
+			continue
+		}
+
+		if !isSensitiveHeader(name) {
+			res[name] = values
+			continue
+		}
+
+		masked := make([]string, len(values))
+		for i, v := range values {
+			masked[i] = redacted
+			if scheme, _, found := strings.Cut(v, " "); found && name == consts.HeaderAuthorization {
+				masked[i] = scheme + " " + redacted
+			}
+		}
+		res[name] = masked
+	}
+	return
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, s := range SensitiveHeaders {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) values(v url.Values) (res map[string][]string) {
+	res = make(map[string][]string, len(v))
+	for k, values := range v {
+		if r.sensitive(k) {
+			res[k] = []string{redacted}
+			continue
+		}
+
+		masked := make([]string, len(values))
+		for i, s := range values {
+			masked[i] = r.string(s)
+		}
+		res[k] = masked
+	}
+	return
+}
+
+// body 依照 content type 遮蔽 body，無法解析時以字串輸出
+func (r *redactor) body(contentType string, b []byte, truncated bool) any {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json":
+		var v any
+		if !truncated && json.Unmarshal(b, &v) == nil {
+			return r.value(v)
+		}
+	case "application/x-www-form-urlencoded":
+		if v, err := url.ParseQuery(string(b)); err == nil {
+			return r.values(v)
+		}
+	}
+
+	s := r.string(string(b))
+	if truncated {
+		// 被截斷的 JSON 無法解析，只能以正規表示式遮蔽欄位
+		s = r.jsonFields(s) + "..."
+	}
+	return s
+}
+
+// any 將任意資料以 JSON 的格式遮蔽，用在 result
+func (r *redactor) any(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var res any
+	if err = json.Unmarshal(b, &res); err != nil {
+		return v
+	}
+
+	return r.value(res)
+}
+
+func (r *redactor) value(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if r.sensitive(k) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = r.value(val)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = r.value(val)
+		}
+	case string:
+		return r.string(t)
+	}
+	return v
+}
+
+var (
+	cardNumberRegexp = regexp.MustCompile(`\d(?:[ -]?\d){12,18}`)
+	jsonFieldRegexp  = regexp.MustCompile(`"([^"\\]+)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,{}\[\]\s]+)`)
+)
+
+func (r *redactor) string(s string) string {
+	if !r.cardNumbers {
+		return s
+	}
+
+	return cardNumberRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(m)
+		if !luhn(digits) {
+			return m
+		}
+		return "****" + digits[len(digits)-4:]
+	})
+}
+
+func (r *redactor) jsonFields(s string) string {
+	return jsonFieldRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sub := jsonFieldRegexp.FindStringSubmatch(m)
+		if !r.sensitive(sub[1]) {
+			return m
+		}
+		return fmt.Sprintf(`"%s":"%s"`, sub[1], redacted)
+	})
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
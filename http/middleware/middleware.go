@@ -1,35 +1,74 @@
 package middleware
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/win30221/core/basic"
+	"github.com/win30221/core/config"
 	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
 	"go.uber.org/zap"
 )
 
-const (
-	SQLLogs = "sqlLogs"
-)
+// SQLLogs 保留給舊的程式使用，新的程式使用 consts.KeySQLLogs
+const SQLLogs = consts.KeySQLLogs
+
+// Log 回傳 access log 相關的 middleware，沒有傳入 policy 時從 consul 的
+// /service/<server_name>/access_log 載入，沒有設定時使用 /system/access_log
+func Log(policy ...LogPolicy) []gin.HandlerFunc {
+	var p LogPolicy
+	if len(policy) > 0 {
+		p = policy[0]
+	} else {
+		p = logPolicyFrom(serviceConfig("access_log"))
+	}
 
-func Log() []gin.HandlerFunc {
 	return []gin.HandlerFunc{
 		RequestIdMiddleware,
-		ginLogger(),
+		ginLogger(p),
+		Recover(),
+	}
+}
+
+// serviceConfig 優先使用 consul 的 /service/<server_name>/<name>，沒有設定時使用 /system/<name>，都沒有時回傳空的設定
+func serviceConfig(name string) config.Values {
+	if v, err := config.GetValues(fmt.Sprintf("/service/%s/%s", basic.ServerName, name), false); err == nil {
+		return v
 	}
+	v, _ := config.GetValues("/system/"+name, false)
+	return v
 }
 
-func ginLogger() gin.HandlerFunc {
+func ginLogger(p LogPolicy) gin.HandlerFunc {
+	r := newRedactor(p)
+
 	return func(c *gin.Context) {
-		c.Set(SQLLogs, []string{})
+		// 先建立請求共用的資料，之後 ctx.New 建立的 Context 都會寫入同一份 sqlLogs、httpLogs
+		ctx := ctx.New(c, c.Request.Context())
+		ctx.Set(consts.KeySQLLogs, []any{})
 		reckon := time.Now()
+
+		var reqBody *capturedBody
+		if p.RequestBody {
+			reqBody = captureRequestBody(c.Request, p)
+		}
+
+		var respBody *responseCapture
+		if p.ResponseBody {
+			respBody = &responseCapture{ResponseWriter: c.Writer, policy: p}
+			c.Writer = respBody
+		}
+
 		c.Next()
 
-		if excludePath(c.Request.RequestURI) {
+		if p.excluded(c.FullPath(), c.Request.URL.Path) {
 			return
 		}
 
@@ -40,16 +79,23 @@ func ginLogger() gin.HandlerFunc {
 		}
 
 		fs := []zap.Field{}
-		fs = append(fs, basicFields(c, reckon)...)
-		fs = append(fs, dumpHeader(c.Request)...)
-		fs = append(fs, dumpForm(c.Request)...)
+		fs = append(fs, basicFields(c, ctx, reckon, r)...)
+		fs = append(fs, zap.Any("HEADER", r.header(c.Request.Header, p.Headers)))
+		fs = append(fs, zap.Any("FORM", dumpForm(c.Request, reqBody, r)))
+		if reqBody.captured() {
+			fs = append(fs, zap.Any("requestBody", r.body(reqBody.contentType, reqBody.data, reqBody.partial())))
+		}
+		if respBody != nil && respBody.capture {
+			fs = append(fs, zap.Any("responseBody", r.body(respBody.Header().Get("Content-Type"), respBody.buf.Bytes(), respBody.truncated)))
+		}
+
 		if err != nil {
 			zap.L().Error(err.Error(), fs...)
 			return
 		}
 
-		if time.Since(reckon).Milliseconds() >= int64(basic.RequestLatencyThrottle) {
-			zap.L().Warn(fmt.Sprintf("over latency %d(ms)", basic.RequestLatencyThrottle), fs...)
+		if latency := p.latency(c.Request.Method, c.FullPath()); latency > 0 && time.Since(reckon) >= latency {
+			zap.L().Warn(fmt.Sprintf("over latency %d(ms)", latency.Milliseconds()), fs...)
 			return
 		}
 
@@ -57,71 +103,145 @@ func ginLogger() gin.HandlerFunc {
 	}
 }
 
-// excludePath 過濾不必要輸出的路徑
-func excludePath(path string) bool {
-	return strings.HasSuffix(path, "/version") ||
-		strings.HasSuffix(path, "/ping")
-}
-
 // basicFields 記錄一些必要的資訊
-func basicFields(c *gin.Context, reckon time.Time) (res []zap.Field) {
+func basicFields(c *gin.Context, ctx *ctx.Context, reckon time.Time, r *redactor) (res []zap.Field) {
 	res = []zap.Field{
 		zap.String("traceCode", c.Request.Header.Get(consts.HeaderXRequestId)),
 		zap.String("method", c.Request.Method),
 		zap.String("uri", c.Request.RequestURI),
 		zap.Int("status", c.Writer.Status()),
-		zap.String("remoteHost", c.Request.RemoteAddr),
+		// 依照 NetworkPolicy.TrustedProxies 解析 X-Forwarded-For 後的 client IP
+		zap.String("remoteHost", c.ClientIP()),
 		zap.Duration("latency", time.Since(reckon)),
 	}
 
 	if basic.PrintDetail {
-		sqlLogs, _ := c.Get(SQLLogs)
-		result, _ := c.Get("result")
+		sqlLogs, _ := ctx.Get(consts.KeySQLLogs)
+		httpLogs, _ := ctx.Get(consts.KeyHTTPLogs)
+		result, _ := ctx.Get("result")
 		res = append(res,
 			zap.Any("sqlLogs", sqlLogs),
-			zap.Any("result", result),
+			zap.Any("httpLogs", httpLogs),
+			zap.Any("result", r.any(result)),
 		)
 	}
 
 	return
 }
 
-// dumpHeader 顯示標頭
-func dumpHeader(req *http.Request) (fs []zap.Field) {
-	fs = []zap.Field{zap.Skip()}
-	if req == nil {
-		return
+// dumpForm 顯示 request 參數，不會讀取 body：
+// handler 已解析過 form 時使用解析的結果，否則只有 query 及 captureRequestBody 記錄下來的 urlencoded body
+func dumpForm(req *http.Request, body *capturedBody, r *redactor) map[string][]string {
+	form := url.Values{}
+	for k, v := range req.URL.Query() {
+		form[k] = v
 	}
 
-	header := make(map[string][]string)
-	v, ok := req.Header[consts.HeaderSysToken]
-	if ok {
-		header[consts.HeaderSysToken] = v
+	switch {
+	case req.PostForm != nil:
+		for k, v := range req.PostForm {
+			form[k] = append(form[k], v...)
+		}
+	case body.captured() && !body.partial():
+		if mediaType, _, _ := mime.ParseMediaType(body.contentType); mediaType == "application/x-www-form-urlencoded" {
+			if v, err := url.ParseQuery(string(body.data)); err == nil {
+				for k, values := range v {
+					form[k] = append(form[k], values...)
+				}
+			}
+		}
 	}
 
-	v, ok = req.Header[consts.HeaderAuthorization]
-	if ok {
-		header[consts.HeaderAuthorization] = v
+	if req.MultipartForm != nil {
+		for k, v := range req.MultipartForm.Value {
+			form[k] = append(form[k], v...)
+		}
 	}
 
-	fs = append(fs, zap.Any("HEADER", header))
+	return r.values(form)
+}
 
-	return
+// capturedBody 記錄 handler 讀取 request body 時的前 BodyLimit 個 byte
+type capturedBody struct {
+	io.ReadCloser
+	contentType string
+	limit       int
+	data        []byte
+	truncated   bool
+	eof         bool
 }
 
-// dumpForm 顯示 request 參數
-func dumpForm(req *http.Request) (fs []zap.Field) {
-	fs = []zap.Field{zap.Skip()}
-	if req == nil {
+// captureRequestBody 不會預先讀取 body，只記錄之後 handler 實際讀取的部分，
+// 因此 BodyLimit 仍會以原本的 body 計算大小，handler 沒有讀取 body 時不會記錄。
+// Log 在 Compress 之前，Content-Encoding 有值（如 gzip）的請求記錄到的是壓縮後的資料，所以不記錄
+func captureRequestBody(req *http.Request, p LogPolicy) (res *capturedBody) {
+	contentType := req.Header.Get("Content-Type")
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" || !p.captureContentType(contentType) {
 		return
 	}
 
-	err := req.ParseForm()
-	if err != nil {
-		zap.L().Error(err.Error())
-		return
+	res = &capturedBody{ReadCloser: req.Body, contentType: contentType, limit: p.BodyLimit}
+	req.Body = res
+	return
+}
+
+func (b *capturedBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+
+	keep := max(min(n, b.limit-len(b.data)), 0)
+	b.data = append(b.data, p[:keep]...)
+	if keep < n {
+		b.truncated = true
 	}
-	fs = append(fs, zap.Any("FORM", req.Form))
 
+	if err == io.EOF {
+		b.eof = true
+	}
 	return
 }
+
+func (b *capturedBody) captured() bool {
+	return b != nil && (len(b.data) > 0 || b.eof)
+}
+
+// partial 超過 BodyLimit 或 handler 沒有讀完 body
+func (b *capturedBody) partial() bool {
+	return b.truncated || !b.eof
+}
+
+// responseCapture 記錄 response body 的前 BodyLimit 個 byte，
+// Log 在 Compress 之前，Content-Encoding 有值的回應記錄到的是壓縮後的資料，所以不記錄
+type responseCapture struct {
+	gin.ResponseWriter
+	policy    LogPolicy
+	checked   bool
+	capture   bool
+	truncated bool
+	buf       bytes.Buffer
+}
+
+func (w *responseCapture) record(b []byte) {
+	if !w.checked {
+		w.checked = true
+		w.capture = w.Header().Get("Content-Encoding") == "" && w.policy.captureContentType(w.Header().Get("Content-Type"))
+	}
+	if !w.capture || w.truncated {
+		return
+	}
+
+	if remain := w.policy.BodyLimit - w.buf.Len(); len(b) > remain {
+		b = b[:remain]
+		w.truncated = true
+	}
+	w.buf.Write(b)
+}
+
+func (w *responseCapture) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCapture) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+	"go.uber.org/zap"
+)
+
+// NetworkConsulPath delivery.SetBasicRouter 載入 NetworkPolicy 的 consul 路徑
+const NetworkConsulPath = "/system/network"
+
+// NetworkPolicy 來源位址的規則
+type NetworkPolicy struct {
+	// AllowCIDRs 允許的來源，可以是 CIDR 或單一 IP，空值時不限制
+	AllowCIDRs []string
+	// TrustedProxies 信任的 proxy，可以是 CIDR 或單一 IP，只有來自這些位址的請求才會採用 RemoteIPHeaders。
+	// nil（沒有設定）時不變更 gin 的設定，空陣列（設定為空字串）時不信任任何 proxy，client IP 一律使用連線的位址
+	TrustedProxies []string
+	// RemoteIPHeaders 取得 client IP 的標頭，空值時使用 gin 的預設值（X-Forwarded-For、X-Real-IP）
+	RemoteIPHeaders []string
+}
+
+// GetNetworkPolicy 從 consul 載入 NetworkPolicy，與 basic.Site 同名的區塊會覆寫最上層的設定
+//
+// 假設 consul 路徑 "/system/network" 內有下列資料
+// `
+//
+//	allow_cidrs = "10.0.0.0/8,172.16.0.0/12"
+//	trusted_proxies = "10.0.0.0/8"
+//	remote_ip_headers = "X-Forwarded-For"
+//	[dev]
+//	allow_cidrs = ""
+//
+// `
+func GetNetworkPolicy(path string) (p NetworkPolicy) {
+	v, err := config.GetValues(path, false)
+	if err != nil {
+		return
+	}
+	v = v.Override(basic.Site)
+
+	p.AllowCIDRs = v.Strings("allow_cidrs")
+	if v.Has("trusted_proxies") {
+		p.TrustedProxies = append([]string{}, v.Strings("trusted_proxies")...)
+	}
+	p.RemoteIPHeaders = v.Strings("remote_ip_headers")
+
+	return
+}
+
+// ApplyTrustedProxies 設定 gin 信任的 proxy，讓 c.ClientIP() 只採用可信任的 X-Forwarded-For，
+// TrustedProxies 為 nil 時保留 gin 原本的設定
+func (p NetworkPolicy) ApplyTrustedProxies(e *gin.Engine) (err error) {
+	if p.TrustedProxies == nil {
+		return
+	}
+
+	if err = e.SetTrustedProxies(p.TrustedProxies); err != nil {
+		err = fmt.Errorf("set trusted proxies error: %s", err.Error())
+		return
+	}
+
+	if len(p.RemoteIPHeaders) > 0 {
+		e.RemoteIPHeaders = p.RemoteIPHeaders
+	}
+
+	return
+}
+
+// IPAllowlist 只允許 AllowCIDRs 中的 client IP，其餘回傳 403 及 syserrno.IPNotAllowed 並記錄 log。
+// client IP 依照 ApplyTrustedProxies 的設定取得，AllowCIDRs 為空值時不限制
+//
+// example:
+//
+//	privateGroup := e.Group("/order", middleware.IPAllowlist(middleware.GetNetworkPolicy(middleware.NetworkConsulPath)))
+func IPAllowlist(p NetworkPolicy) gin.HandlerFunc {
+	nets := parseCIDRs(p.AllowCIDRs)
+
+	return func(c *gin.Context) {
+		if len(p.AllowCIDRs) == 0 {
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		if ip := net.ParseIP(clientIP); ip != nil {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		zap.L().Warn("network policy: ip not allowed",
+			zap.String("clientIP", clientIP),
+			zap.String("remoteAddr", c.Request.RemoteAddr),
+			zap.String("forwardedFor", c.Request.Header.Get("X-Forwarded-For")),
+			zap.String("service", c.Request.Header.Get(consts.HeaderXService)),
+			zap.String("method", c.Request.Method),
+			zap.String("uri", c.Request.RequestURI),
+			zap.String("traceCode", c.Request.Header.Get(consts.HeaderXRequestId)),
+		)
+
+		ctx := ctx.New(c, c.Request.Context())
+		response.Error(ctx, http.StatusForbidden, catch.New(
+			syserrno.IPNotAllowed,
+			"forbidden",
+			fmt.Sprintf("ip %s is not allowed", clientIP),
+		))
+		c.Abort()
+	}
+}
+
+// parseCIDRs 單一 IP 視為 /32 或 /128，無法解析的項目記錄 log 後略過
+func parseCIDRs(list []string) (res []*net.IPNet) {
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				zap.L().Warn(fmt.Sprintf("network policy: ignore invalid ip `%s`", s))
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("network policy: ignore invalid cidr `%s`: %s", s, err.Error()))
+			continue
+		}
+		res = append(res, n)
+	}
+
+	return
+}
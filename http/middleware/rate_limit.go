@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/ratelimit"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+	"go.uber.org/zap"
+)
+
+// RateLimit 依照 rules 限制請求頻率，每個路由使用第一個相符的規則，沒有相符時使用 Route 為空值的預設規則，
+// 都沒有時不限制，沒有相符路由的請求（404）也不限制。回應會帶上 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset 標頭，
+// 超過時回傳 429 及 Retry-After。store 發生錯誤時放行並記錄 log
+//
+// key 為 user 或 caller 時需要放在 JWT 或 VerifySignature 之後，取不到時改用 ip 計算
+//
+// example:
+//
+//	e.Use(middleware.RateLimit(ratelimit.NewRedisStore(storage.GetRedis(...)), ratelimit.GetRules("/service/order/rate_limit")...))
+func RateLimit(store ratelimit.Store, rules ...ratelimit.Rule) gin.HandlerFunc {
+	valid := make([]ratelimit.Rule, 0, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			zap.L().Warn(fmt.Sprintf("ignore invalid rate limit rule %+v: %s", r, err.Error()))
+			continue
+		}
+		valid = append(valid, r)
+	}
+
+	return func(c *gin.Context) {
+		// 沒有相符的路由（404）時 FullPath 為空值，不限制，避免所有不存在的路徑共用同一份額度
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		rule, ok := matchRule(valid, c.Request.Method, c.FullPath())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		key := rateLimitKey(c, rule)
+		res, err := store.Allow(c.Request.Context(), key, rule)
+		if err != nil {
+			zap.L().Warn("rate limit store error: "+err.Error(), zap.String("key", key))
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set(consts.HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+		h.Set(consts.HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+		h.Set(consts.HeaderRateLimitReset, ceilSeconds(res.Reset))
+
+		if res.Allowed {
+			c.Next()
+			return
+		}
+
+		h.Set(consts.HeaderRetryAfter, ceilSeconds(max(res.RetryAfter, time.Second)))
+
+		ctx := ctx.New(c, c.Request.Context())
+		response.Error(ctx, http.StatusTooManyRequests, catch.New(
+			syserrno.TooManyRequests,
+			"too many requests",
+			fmt.Sprintf("rate limit exceeded, key: %s, rule: %+v", key, rule),
+		))
+		c.Abort()
+	}
+}
+
+// matchRule 先找 "METHOD /path"，再找 "/path"，最後使用預設規則
+func matchRule(rules []ratelimit.Rule, method, fullPath string) (res ratelimit.Rule, ok bool) {
+	var pathRule, defaultRule *ratelimit.Rule
+	for i := range rules {
+		switch rules[i].Route {
+		case method + " " + fullPath:
+			return rules[i], true
+		case fullPath:
+			if pathRule == nil {
+				pathRule = &rules[i]
+			}
+		case "":
+			if defaultRule == nil {
+				defaultRule = &rules[i]
+			}
+		}
+	}
+
+	switch {
+	case pathRule != nil:
+		return *pathRule, true
+	case defaultRule != nil:
+		return *defaultRule, true
+	}
+
+	return
+}
+
+func rateLimitKey(c *gin.Context, rule ratelimit.Rule) string {
+	// 預設規則套用在所有路由，每個路由各自計算額度
+	route := rule.Route
+	if route == "" {
+		route = c.Request.Method + " " + c.FullPath()
+	}
+	route = strings.ReplaceAll(route, " ", ":")
+
+	switch rule.Key {
+	case ratelimit.KeyRoute:
+		return route
+	case ratelimit.KeyUser:
+		if id := c.GetString(consts.KeyUserID); id != "" {
+			return route + ":user:" + id
+		}
+	case ratelimit.KeyCaller:
+		if caller := c.GetString(consts.KeyCaller); caller != "" {
+			return route + ":caller:" + caller
+		}
+	}
+
+	return route + ":ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ratelimit"
+)
+
+func Test_matchRule(t *testing.T) {
+	rules := []ratelimit.Rule{
+		{Route: "", Limit: 1},
+		{Route: "/order/:id", Limit: 2},
+		{Route: "POST /order/:id", Limit: 3},
+		{Route: "/order/:id", Limit: 4},
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		fullPath  string
+		wantLimit int
+	}{
+		{name: "method and path", method: http.MethodPost, fullPath: "/order/:id", wantLimit: 3},
+		{name: "first path rule", method: http.MethodGet, fullPath: "/order/:id", wantLimit: 2},
+		{name: "default rule", method: http.MethodGet, fullPath: "/user/:id", wantLimit: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchRule(rules, tt.method, tt.fullPath)
+			if !ok || got.Limit != tt.wantLimit {
+				t.Errorf("matchRule() = %+v, %v, want limit %d", got, ok, tt.wantLimit)
+			}
+		})
+	}
+
+	if _, ok := matchRule(rules[1:2], http.MethodGet, "/user/:id"); ok {
+		t.Error("matchRule() without default rule ok = true, want false")
+	}
+}
+
+func Test_rateLimitKey(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ratelimit.Rule
+		keys map[string]any
+		want string
+	}{
+		{name: "default rule by ip", rule: ratelimit.Rule{Key: ratelimit.KeyIP}, want: "GET:/order/:id:ip:10.0.0.1"},
+		{name: "route", rule: ratelimit.Rule{Route: "GET /order/:id", Key: ratelimit.KeyRoute}, want: "GET:/order/:id"},
+		{name: "user", rule: ratelimit.Rule{Key: ratelimit.KeyUser}, keys: map[string]any{consts.KeyUserID: "u1"}, want: "GET:/order/:id:user:u1"},
+		{name: "user fallback to ip", rule: ratelimit.Rule{Key: ratelimit.KeyUser}, want: "GET:/order/:id:ip:10.0.0.1"},
+		{name: "caller", rule: ratelimit.Rule{Route: "/order/:id", Key: ratelimit.KeyCaller}, keys: map[string]any{consts.KeyCaller: "member"}, want: "/order/:id:caller:member"},
+		{name: "caller fallback to ip", rule: ratelimit.Rule{Route: "/order/:id", Key: ratelimit.KeyCaller}, want: "/order/:id:ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			e := gin.New()
+			e.GET("/order/:id", func(c *gin.Context) {
+				for k, v := range tt.keys {
+					c.Set(k, v)
+				}
+				got = rateLimitKey(c, tt.rule)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	basic.TimeZone = time.UTC
+
+	e := gin.New()
+	e.Use(RateLimit(ratelimit.NewMemoryStore(), ratelimit.Rule{Limit: 1, Period: time.Hour}))
+	e.GET("/order/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := do("/order/1")
+	if w.Code != http.StatusOK || w.Header().Get(consts.HeaderRateLimitRemaining) != "0" {
+		t.Fatalf("first request = %d %v, want 200 with 0 remaining", w.Code, w.Header())
+	}
+
+	// 同一個路由的不同路徑共用額度
+	w = do("/order/2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(consts.HeaderRetryAfter) == "" {
+		t.Errorf("second request = %d %v, want 429 with Retry-After", w.Code, w.Header())
+	}
+
+	// 不存在的路由不限制
+	for i := 0; i < 2; i++ {
+		w = do("/unknown")
+		if w.Code != http.StatusNotFound || w.Header().Get(consts.HeaderRateLimitLimit) != "" {
+			t.Errorf("unmatched request = %d %v, want 404 without rate limit headers", w.Code, w.Header())
+		}
+	}
+}
+
+// ValidateToken 無法分辨呼叫端，依呼叫端限流時 SysToken 的請求以 IP 計算
+func TestRateLimit_callerWithSysToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	basic.TimeZone = time.UTC
+
+	e := gin.New()
+	e.Use(ValidateToken("token"), RateLimit(ratelimit.NewMemoryStore(), ratelimit.Rule{Limit: 1, Period: time.Hour, Key: ratelimit.KeyCaller}))
+	e.GET("/order/:id", func(c *gin.Context) {
+		if caller := c.GetString(consts.KeyCaller); caller != "" {
+			t.Errorf("caller = %q, want empty", caller)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	do := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+		req.Header.Set(consts.HeaderSysToken, "token")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do("10.0.0.1:1234"); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	if code := do("10.0.0.2:1234"); code != http.StatusOK {
+		t.Errorf("request from another ip = %d, want 200", code)
+	}
+	if code := do("10.0.0.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("second request from the same ip = %d, want 429", code)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"go.uber.org/zap"
+)
+
+// Recover 攔截 handler 的 panic，轉為 syserrno.Undefined 的 catch 錯誤並以標準格式回傳，
+// 需要放在 ginLogger 之後，錯誤及完整的 stack 才會被 ginLogger 記錄下來。
+// http.ErrAbortHandler 是中斷回應的訊號，會繼續 panic 讓 net/http 關閉連線
+func Recover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			err := catch.Panic(rec)
+
+			// client 已斷線，不需要回傳
+			if isBrokenPipe(rec) {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			// 已經開始回傳資料，無法再改寫 response
+			if c.Writer.Written() {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			ctx := ctx.New(c, c.Request.Context())
+			response.Error(ctx, http.StatusInternalServerError, err)
+			c.Abort()
+		}()
+
+		c.Next()
+	}
+}
+
+// RecoverFunc 執行 fn 並攔截 panic，用在 rmq consumer 或 cron-job 等沒有 gin 的地方，
+// panic 或 fn 回傳的錯誤都會連同 traceCode 記錄下來，http.ErrAbortHandler 會繼續 panic
+//
+// example:
+//
+//	for d := range deliveries {
+//		middleware.RecoverFunc(ctx.NewEmpty(), "order.created", func(c *ctx.Context) error {
+//			return handleOrderCreated(c, d)
+//		})
+//	}
+func RecoverFunc(c *ctx.Context, name string, fn func(c *ctx.Context) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			err = catch.Panic(rec)
+		}
+
+		if err == nil {
+			return
+		}
+
+		fs := []zap.Field{
+			zap.String("traceCode", c.TraceCode),
+			zap.String("job", name),
+		}
+
+		if e, ok := catch.CheckCustomError(err); ok {
+			_, _, logMsg, stack := e.Info()
+			zap.L().Error(logMsg, append(fs, zap.String("stack", stack))...)
+			return
+		}
+
+		zap.L().Error(err.Error(), fs...)
+	}()
+
+	err = fn(c)
+
+	return
+}
+
+func isBrokenPipe(rec any) bool {
+	err, ok := rec.(error)
+	if !ok {
+		return false
+	}
+
+	var ne *net.OpError
+	if !errors.As(err, &ne) {
+		return false
+	}
+
+	var se *os.SyscallError
+	if !errors.As(ne, &se) {
+		return false
+	}
+
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
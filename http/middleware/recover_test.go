@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+func TestRecover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	basic.TimeZone = time.UTC
+
+	e := gin.New()
+	e.Use(Recover())
+	e.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	e.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(consts.HeaderXRequestId, "trace-1")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	var res response.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unmarshal response error: %v, body: %s", err, w.Body.String())
+	}
+	if w.Code != http.StatusInternalServerError || res.Status.Code != syserrno.Undefined || res.Status.Message != "internal server error" || res.Status.TraceCode != "trace-1" {
+		t.Errorf("panic response = %d %+v, want 500 with the core error envelope", w.Code, res.Status)
+	}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("recover() = %v, want http.ErrAbortHandler", rec)
+			}
+		}()
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+}
+
+func TestRecoverFunc(t *testing.T) {
+	basic.TimeZone = time.UTC
+
+	err := RecoverFunc(ctx.NewEmpty(), "job", func(c *ctx.Context) error {
+		panic(errors.New("boom"))
+	})
+	if err == nil {
+		t.Error("RecoverFunc() error = nil, want the panic error")
+	}
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recover() = %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	RecoverFunc(ctx.NewEmpty(), "job", func(c *ctx.Context) error {
+		panic(http.ErrAbortHandler)
+	})
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+// TimeoutPolicy 請求的處理時間上限
+type TimeoutPolicy struct {
+	// Default 沒有設定在 Routes 中的路由使用的時間，0 為不限制
+	Default time.Duration
+	// Routes 針對 "METHOD /path"（gin 的 FullPath）設定不同的時間，0 為不限制
+	Routes map[string]time.Duration
+}
+
+// GetTimeoutPolicy 從 consul 載入 TimeoutPolicy
+//
+// 假設 consul 路徑 "/service/order/timeout" 內有下列資料
+// `
+//
+//	default = "10s"
+//	[routes]
+//	"GET /order/report" = "60s"
+//
+// `
+func GetTimeoutPolicy(path string) (p TimeoutPolicy) {
+	v, _ := config.GetValues(path, false)
+	return timeoutPolicyFrom(v)
+}
+
+func timeoutPolicyFrom(v config.Values) (p TimeoutPolicy) {
+	if d, ok := v.Duration("default"); ok {
+		p.Default = d
+	}
+
+	routes := v.Section("routes")
+	for route := range routes {
+		// route example: get /order/report
+		d, ok := routes.Duration(route)
+		if !ok {
+			continue
+		}
+		if p.Routes == nil {
+			p.Routes = map[string]time.Duration{}
+		}
+		method, path, _ := strings.Cut(route, " ")
+		p.Routes[strings.ToUpper(method)+" "+path] = d
+	}
+
+	return
+}
+
+// timeout Routes 的 key 不分大小寫（consul 的 key 會被轉為小寫）
+func (p TimeoutPolicy) timeout(method, fullPath string) time.Duration {
+	route := method + " " + fullPath
+	for k, d := range p.Routes {
+		if strings.EqualFold(k, route) {
+			return d
+		}
+	}
+	return p.Default
+}
+
+// Timeout 為每個請求設定處理期限，沒有傳入 policy 時從 consul 的 /service/<server_name>/timeout 載入，
+// 沒有設定時使用 /system/timeout。
+//
+// 通過 ValidateToken、VerifySignature 或 InternalAuth 驗證的內部服務請求帶有 X-Request-Timeout 時
+// （由 http/request 帶上呼叫端剩餘的時間）取較短的一方，所以要沿用呼叫端的期限時 Timeout 需要放在這些 middleware 之後，
+// 未經驗證的請求會忽略 X-Request-Timeout，避免外部的請求任意縮短期限。
+//
+// 期限會透過 ctx.Context.Context 傳遞給 http/request、MySQL、Mongo、Redis 及 RabbitMQ，
+// 逾時後這些操作會回傳錯誤，但 Timeout 不會中斷 handler，handler 沒有使用 ctx.Context 時會繼續執行到結束。
+// handler 結束時期限已過且尚未回應才回傳 504 及 syserrno.Timeout
+//
+// example:
+//
+//	privateGroup.Use(middleware.Timeout())
+func Timeout(policy ...TimeoutPolicy) gin.HandlerFunc {
+	var p TimeoutPolicy
+	if len(policy) > 0 {
+		p = policy[0]
+	} else {
+		p = timeoutPolicyFrom(serviceConfig("timeout"))
+	}
+
+	return func(c *gin.Context) {
+		timeout := p.timeout(c.Request.Method, c.FullPath())
+		if d, ok := inboundTimeout(c); ok && (timeout == 0 || d < timeout) {
+			timeout = d
+		}
+
+		if timeout == 0 {
+			c.Next()
+			return
+		}
+
+		deadline, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(deadline)
+
+		c.Next()
+
+		if !errors.Is(deadline.Err(), context.DeadlineExceeded) || c.Writer.Written() {
+			return
+		}
+
+		ctx := ctx.New(c, deadline)
+		response.Error(ctx, http.StatusGatewayTimeout, catch.New(
+			syserrno.Timeout,
+			"request timeout",
+			fmt.Sprintf("request deadline exceeded, timeout: %s", timeout),
+		))
+	}
+}
+
+// inboundTimeout 讀取內部服務帶上的 X-Request-Timeout
+func inboundTimeout(c *gin.Context) (d time.Duration, ok bool) {
+	if !c.GetBool(consts.KeyInternal) {
+		return
+	}
+
+	v := c.Request.Header.Get(consts.HeaderXRequestTimeout)
+	if v == "" {
+		return
+	}
+
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms <= 0 {
+		return
+	}
+
+	return time.Duration(ms) * time.Millisecond, true
+}
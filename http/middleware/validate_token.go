@@ -1,14 +1,19 @@
 package middleware
 
 import (
-	"errors"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	validator "github.com/go-playground/validator/v10"
+	"github.com/win30221/core/http/catch"
 	"github.com/win30221/core/http/consts"
 	"github.com/win30221/core/http/ctx"
 	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+	"go.uber.org/zap"
 )
 
 // 驗證內部服務間溝通用的 middleware
@@ -20,13 +25,56 @@ func (v *Validator) Validate(i any) error {
 	return v.validate.Struct(i)
 }
 
-func ValidateToken(sysToken string) gin.HandlerFunc {
+// ValidateToken 驗證 SysToken 標頭，sysTokens 中任一個相符即通過，空字串會被忽略。
+// 輪替 /system/systoken 時先將新的 token 加入 /system/systokens 讓被呼叫端同時接受新舊 token，
+// 呼叫端全部更新後再移除舊的 token。
+// SysToken 由所有服務共用，無法分辨呼叫端，所以不會設定 consts.KeyCaller（依呼叫端限流時會改以 IP 計算）
+func ValidateToken(sysTokens ...string) gin.HandlerFunc {
+	// 先取 hash 讓比對的長度固定，避免從比對時間推測 token 長度
+	hashes := [][32]byte{}
+	for _, t := range sysTokens {
+		if t != "" {
+			hashes = append(hashes, sha256.Sum256([]byte(t)))
+		}
+	}
+
 	return func(c *gin.Context) {
-		if c.Request.Header.Get(consts.HeaderSysToken) != sysToken {
-			ctx := ctx.New(c, c.Request.Context())
-			response.Error(ctx, http.StatusBadRequest, errors.New("validate system token error"))
-			c.Abort()
+		if validToken(hashes, c.Request.Header.Get(consts.HeaderSysToken)) {
+			c.Set(consts.KeyInternal, true)
+			c.Next()
+			return
 		}
-		c.Next()
+
+		zap.L().Warn("validate system token error",
+			zap.String("traceCode", c.Request.Header.Get(consts.HeaderXRequestId)),
+			zap.String("method", c.Request.Method),
+			zap.String("uri", c.Request.RequestURI),
+			zap.String("clientIP", c.ClientIP()),
+			zap.String("remoteAddr", c.Request.RemoteAddr),
+		)
+
+		ctx := ctx.New(c, c.Request.Context())
+		response.Error(ctx, http.StatusUnauthorized, catch.New(
+			syserrno.InvalidSysToken,
+			"validate system token error",
+			fmt.Sprintf("validate system token error, remote: %s", c.Request.RemoteAddr),
+		))
+		c.Abort()
+	}
+}
+
+func validToken(hashes [][32]byte, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	h := sha256.Sum256([]byte(token))
+
+	// 比對所有 token 不提前結束，讓耗費的時間與哪一個 token 相符無關
+	match := 0
+	for i := range hashes {
+		match |= subtle.ConstantTimeCompare(h[:], hashes[i][:])
 	}
+
+	return match == 1
 }
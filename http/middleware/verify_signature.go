@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/http/sign"
+	"github.com/win30221/core/syserrno"
+)
+
+// VerifySignature 驗證內部服務的簽章（參考 http/sign），通過後呼叫端的服務名稱可以從 ctx.Context.Caller 取得
+func VerifySignature(v *sign.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, err := v.Verify(c.Request)
+		if err != nil {
+			ctx := ctx.New(c, c.Request.Context())
+			response.Error(ctx, http.StatusUnauthorized, catch.Wrap(
+				err,
+				syserrno.InvalidSignature,
+				"invalid signature",
+				fmt.Sprintf("verify signature error: %s, service: %s, remote: %s, uri: %s", err.Error(), c.Request.Header.Get(consts.HeaderXService), c.ClientIP(), c.Request.RequestURI),
+			))
+			c.Abort()
+			return
+		}
+
+		c.Set(consts.KeyCaller, service)
+		c.Set(consts.KeyInternal, true)
+		c.Next()
+	}
+}
+
+// InternalAuth 驗證內部服務的身分，帶有簽章標頭（X-Signature）的 request 以 VerifySignature 驗證，
+// 其餘以 ValidateToken 驗證 SysToken。用在呼叫端從 SysToken 移轉到簽章的期間，
+// 所有呼叫端都改用簽章後不再傳入 sysTokens，就只接受簽章
+func InternalAuth(v *sign.Verifier, sysTokens ...string) gin.HandlerFunc {
+	verify := VerifySignature(v)
+
+	var token gin.HandlerFunc
+	for _, t := range sysTokens {
+		if t != "" {
+			token = ValidateToken(sysTokens...)
+			break
+		}
+	}
+
+	return func(c *gin.Context) {
+		if token == nil || c.Request.Header.Get(consts.HeaderXSignature) != "" {
+			verify(c)
+			return
+		}
+		token(c)
+	}
+}
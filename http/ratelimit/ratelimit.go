@@ -0,0 +1,214 @@
+/*
+package ratelimit 提供 middleware.RateLimit 使用的限流規則及演算法，
+單一 instance 使用 MemoryStore，多個 instance 共用額度時使用 RedisStore。
+*/
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/win30221/core/config"
+)
+
+type Algorithm string
+
+const (
+	// TokenBucket 每 Period 補充 Limit 個 token，最多累積 Burst 個，允許短時間的突發流量
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow 任意 Period 長度的區間內最多 Limit 個請求（以前後兩個固定區間加權估算）
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// 計算額度時使用的對象，KeyUser、KeyCaller 取不到身分時改以 IP 計算
+const (
+	KeyIP   = "ip"
+	KeyUser = "user"
+	// KeyCaller 只有通過簽章驗證（VerifySignature、InternalAuth）的請求有呼叫端名稱，
+	// 所有服務共用 SysToken，ValidateToken 無法分辨呼叫端，以 SysToken 驗證的請求依照 IP 計算
+	KeyCaller = "caller"
+	KeyRoute  = "route"
+)
+
+// Rule 限流規則
+type Rule struct {
+	// Route 套用的路由，格式為 "METHOD /path"（gin 的 FullPath，如 "GET /order/order/:id"）或只有 "/path"，空值為預設規則
+	Route     string
+	Algorithm Algorithm
+	// Limit 每個 Period 允許的請求數
+	Limit int
+	// Period 最小為 1ms，redis 以毫秒計算補充速率
+	Period time.Duration
+	// Burst TokenBucket 的容量，預設與 Limit 相同
+	Burst int
+	// Key 計算額度的對象：ip、user（JWT 的 user id）、caller（簽章驗證的呼叫端服務）、route（所有人共用），預設為 ip
+	Key string
+}
+
+func (r Rule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// ttl 閒置多久後額度會完全恢復，之後可以刪除記錄
+func (r Rule) ttl() time.Duration {
+	if r.Algorithm == SlidingWindow {
+		return 2 * r.Period
+	}
+
+	ttl := time.Duration(float64(r.burst()) / float64(r.Limit) * float64(r.Period))
+	if ttl < r.Period {
+		ttl = r.Period
+	}
+	return ttl
+}
+
+// Result 單次請求的限流結果，用來產生 RateLimit-* 標頭
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset 額度完全恢復所需的時間
+	Reset time.Duration
+	// RetryAfter 被拒絕時到下一次可以通過所需的時間
+	RetryAfter time.Duration
+}
+
+// Store 記錄各 key 使用的額度
+type Store interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+// tokenBucketResult tokens 為扣除本次請求後剩餘的 token
+func tokenBucketResult(rule Rule, allowed bool, tokens float64) (res Result) {
+	capacity := float64(rule.burst())
+	perToken := rule.Period / time.Duration(rule.Limit)
+
+	res = Result{
+		Allowed:   allowed,
+		Limit:     rule.burst(),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((capacity - tokens) * float64(perToken)),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+
+	return
+}
+
+// slidingWindowResult curr, prev 為目前及前一個區間的請求數（通過時已包含本次請求），elapsed 為目前區間經過的時間
+func slidingWindowResult(rule Rule, allowed bool, curr, prev float64, elapsed time.Duration) (res Result) {
+	weight := 1 - float64(elapsed)/float64(rule.Period)
+	used := prev*weight + curr
+	limit := float64(rule.Limit)
+
+	res = Result{
+		Allowed:   allowed,
+		Limit:     rule.Limit,
+		Remaining: int(math.Max(0, math.Floor(limit-used))),
+		Reset:     rule.Period - elapsed,
+	}
+
+	if !allowed {
+		switch {
+		case curr+1 > limit || prev == 0:
+			// 要等到下一個區間
+			res.RetryAfter = rule.Period - elapsed
+		default:
+			// prev*(1-(elapsed+t)/period) + curr + 1 <= limit
+			t := float64(rule.Period)*(1-(limit-curr-1)/prev) - float64(elapsed)
+			res.RetryAfter = time.Duration(math.Max(0, t))
+		}
+	}
+
+	return
+}
+
+// GetRules 從 consul 載入限流規則
+//
+// 假設 consul 路徑 "/service/order/rate_limit" 內有下列資料
+// `
+//
+//	[[rules]]
+//	algorithm = "token_bucket"
+//	limit = 100
+//	period = "1m"
+//	burst = 200
+//	key = "ip"
+//
+//	[[rules]]
+//	route = "POST /order/order"
+//	algorithm = "sliding_window"
+//	limit = 10
+//	period = "1m"
+//	key = "user"
+//
+// `
+//
+// 使用 GetRules("/service/order/rate_limit")，沒有 route 的規則為預設規則
+func GetRules(path string) (rules []Rule) {
+	config.Get(path+"/rules", false, func(res any) (err error) {
+		defer func() {
+			if err != nil {
+				rules = nil
+			}
+		}()
+
+		for i, item := range cast.ToSlice(res) {
+			m := cast.ToStringMap(item)
+
+			rule := Rule{
+				Route:     strings.TrimSpace(cast.ToString(m["route"])),
+				Algorithm: Algorithm(cast.ToString(m["algorithm"])),
+				Limit:     cast.ToInt(m["limit"]),
+				Burst:     cast.ToInt(m["burst"]),
+				Key:       cast.ToString(m["key"]),
+			}
+
+			rule.Period, err = time.ParseDuration(cast.ToString(m["period"]))
+			if err != nil {
+				return fmt.Errorf("rules[%d] parse period error: %s", i, err.Error())
+			}
+
+			if err = rule.Validate(); err != nil {
+				return fmt.Errorf("rules[%d] %s", i, err.Error())
+			}
+
+			rules = append(rules, rule)
+		}
+		return
+	})
+
+	return
+}
+
+// Validate 檢查規則並補上預設值
+func (r *Rule) Validate() (err error) {
+	if r.Algorithm == "" {
+		r.Algorithm = TokenBucket
+	}
+	if r.Key == "" {
+		r.Key = KeyIP
+	}
+
+	switch {
+	case r.Algorithm != TokenBucket && r.Algorithm != SlidingWindow:
+		err = fmt.Errorf("unsupported algorithm `%s`", r.Algorithm)
+	case r.Limit <= 0 || r.Period <= 0:
+		err = fmt.Errorf("limit and period must be greater than 0")
+	case r.Period < time.Millisecond:
+		err = fmt.Errorf("period must be at least 1ms")
+	case r.Key != KeyIP && r.Key != KeyUser && r.Key != KeyCaller && r.Key != KeyRoute:
+		err = fmt.Errorf("unsupported key `%s`", r.Key)
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "default", rule: Rule{Limit: 1, Period: time.Second}},
+		{name: "sliding window by user", rule: Rule{Algorithm: SlidingWindow, Limit: 1, Period: time.Second, Key: KeyUser}},
+		{name: "unsupported algorithm", rule: Rule{Algorithm: "leaky_bucket", Limit: 1, Period: time.Second}, wantErr: true},
+		{name: "zero limit", rule: Rule{Period: time.Second}, wantErr: true},
+		{name: "zero period", rule: Rule{Limit: 1}, wantErr: true},
+		{name: "sub-millisecond period", rule: Rule{Limit: 1, Period: time.Microsecond}, wantErr: true},
+		{name: "unsupported key", rule: Rule{Limit: 1, Period: time.Second, Key: "session"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.rule.Algorithm == "" || tt.rule.Key == "") {
+				t.Errorf("Validate() did not fill defaults: %+v", tt.rule)
+			}
+		})
+	}
+}
+
+func Test_tokenBucketResult(t *testing.T) {
+	rule := Rule{Limit: 10, Period: 10 * time.Second, Burst: 20}
+
+	res := tokenBucketResult(rule, true, 15.5)
+	if res.Limit != 20 || res.Remaining != 15 || res.Reset != 4500*time.Millisecond || res.RetryAfter != 0 {
+		t.Errorf("allowed result = %+v", res)
+	}
+
+	res = tokenBucketResult(rule, false, 0.25)
+	if res.Remaining != 0 || res.RetryAfter != 750*time.Millisecond {
+		t.Errorf("rejected result = %+v", res)
+	}
+}
+
+func Test_slidingWindowResult(t *testing.T) {
+	rule := Rule{Algorithm: SlidingWindow, Limit: 10, Period: 10 * time.Second}
+
+	tests := []struct {
+		name          string
+		allowed       bool
+		curr, prev    float64
+		elapsed       time.Duration
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "allowed", allowed: true, curr: 3, prev: 4, elapsed: 5 * time.Second, wantRemaining: 5},
+		{name: "current window full", curr: 10, prev: 0, elapsed: 2 * time.Second, wantRetry: 8 * time.Second},
+		// 8*(1-(2+t)/10) + 7 + 1 <= 10 => t >= 5.5s
+		{name: "previous window decays", curr: 7, prev: 8, elapsed: 2 * time.Second, wantRetry: 5500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := slidingWindowResult(rule, tt.allowed, tt.curr, tt.prev, tt.elapsed)
+			if res.Remaining != tt.wantRemaining || res.RetryAfter != tt.wantRetry || res.Reset != rule.Period-tt.elapsed {
+				t.Errorf("slidingWindowResult() = %+v, want remaining %d, retry after %s", res, tt.wantRemaining, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_tokenBucket(t *testing.T) {
+	s := NewMemoryStore()
+	rule := Rule{Limit: 1, Period: time.Hour, Burst: 3}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		res, _ := s.Allow(context.Background(), "a", rule)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, res, 2-i)
+		}
+	}
+
+	res, _ := s.Allow(context.Background(), "a", rule)
+	if res.Allowed || res.RetryAfter <= 59*time.Minute {
+		t.Errorf("request over burst = %+v, want rejected for about an hour", res)
+	}
+
+	// 不同 key 各自計算額度
+	if res, _ := s.Allow(context.Background(), "b", rule); !res.Allowed {
+		t.Errorf("other key = %+v, want allowed", res)
+	}
+}
+
+func TestMemoryStore_tokenBucketRefill(t *testing.T) {
+	s := NewMemoryStore()
+	rule := Rule{Limit: 1, Period: 50 * time.Millisecond}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, _ := s.Allow(context.Background(), "a", rule); !res.Allowed {
+		t.Fatalf("first request = %+v, want allowed", res)
+	}
+	if res, _ := s.Allow(context.Background(), "a", rule); res.Allowed {
+		t.Fatalf("second request = %+v, want rejected", res)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if res, _ := s.Allow(context.Background(), "a", rule); !res.Allowed {
+		t.Errorf("request after refill = %+v, want allowed", res)
+	}
+}
+
+func TestMemoryStore_slidingWindow(t *testing.T) {
+	s := NewMemoryStore()
+	rule := Rule{Algorithm: SlidingWindow, Limit: 2, Period: time.Hour}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res, _ := s.Allow(context.Background(), "a", rule); !res.Allowed {
+			t.Fatalf("request %d = %+v, want allowed", i, res)
+		}
+	}
+
+	res, _ := s.Allow(context.Background(), "a", rule)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != res.Reset {
+		t.Errorf("request over limit = %+v, want rejected until the next window", res)
+	}
+}
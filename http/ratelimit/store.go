@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+)
+
+// MemoryStore 單一 instance 使用的 Store，服務有多個 instance 時每個 instance 各自計算額度
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	window      int64
+	curr, prev  float64
+	expireAfter time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*entry{}}
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, rule Rule) (res Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{tokens: float64(rule.burst()), last: now}
+		s.entries[key] = e
+	}
+	e.expireAfter = now.Add(rule.ttl())
+
+	switch rule.Algorithm {
+	case SlidingWindow:
+		window := now.UnixNano() / int64(rule.Period)
+		elapsed := time.Duration(now.UnixNano() - window*int64(rule.Period))
+		switch {
+		case e.window == window-1:
+			e.prev, e.curr = e.curr, 0
+		case e.window != window:
+			e.prev, e.curr = 0, 0
+		}
+		e.window = window
+
+		weight := 1 - float64(elapsed)/float64(rule.Period)
+		allowed := e.prev*weight+e.curr+1 <= float64(rule.Limit)
+		if allowed {
+			e.curr++
+		}
+		res = slidingWindowResult(rule, allowed, e.curr, e.prev, elapsed)
+	default:
+		rate := float64(rule.Limit) / float64(rule.Period)
+		e.tokens = math.Min(float64(rule.burst()), e.tokens+float64(now.Sub(e.last))*rate)
+		e.last = now
+
+		allowed := e.tokens >= 1
+		if allowed {
+			e.tokens--
+		}
+		res = tokenBucketResult(rule, allowed, e.tokens)
+	}
+
+	return
+}
+
+// sweep 每分鐘清除一次過期的 key
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for k, e := range s.entries {
+		if now.After(e.expireAfter) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// RedisStore 以 Lua script 在 redis 中計算額度，多個 instance 共用，時間以 redis server 為準
+type RedisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisStore rdb 可以使用 storage.GetRedis 取得
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb, prefix: "ratelimit:"}
+}
+
+// 回傳 {allowed, tokens}，浮點數需要轉為字串才不會被 redis 轉為整數
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// 回傳 {allowed, curr, prev, elapsed}，兩個區間放在同一個 key 以相容 redis cluster
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = math.floor(now / period)
+local elapsed = now - window * period
+
+local state = redis.call('HMGET', KEYS[1], 'w', 'c', 'p')
+local w = tonumber(state[1])
+local curr = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if w == window - 1 then
+	prev = curr
+	curr = 0
+elseif w ~= window then
+	prev = 0
+	curr = 0
+end
+
+local allowed = 0
+if prev * (1 - elapsed / period) + curr + 1 <= limit then
+	curr = curr + 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'w', window, 'c', curr, 'p', prev)
+redis.call('PEXPIRE', KEYS[1], period * 2)
+return {allowed, curr, prev, elapsed}
+`)
+
+func (s *RedisStore) Allow(ctx context.Context, key string, rule Rule) (res Result, err error) {
+	switch rule.Algorithm {
+	case SlidingWindow:
+		var v []any
+		v, err = slidingWindowScript.Run(ctx, s.rdb, []string{s.prefix + key}, rule.Limit, rule.Period.Milliseconds()).Slice()
+		if err != nil {
+			err = fmt.Errorf("run sliding window script error: %w", err)
+			return
+		}
+		if len(v) != 4 {
+			err = fmt.Errorf("unexpected sliding window script result: %v", v)
+			return
+		}
+		res = slidingWindowResult(rule, cast.ToInt(v[0]) == 1, cast.ToFloat64(v[1]), cast.ToFloat64(v[2]), time.Duration(cast.ToInt64(v[3]))*time.Millisecond)
+	default:
+		rate := float64(rule.Limit) / float64(rule.Period.Milliseconds())
+		var v []any
+		v, err = tokenBucketScript.Run(ctx, s.rdb, []string{s.prefix + key}, rule.burst(), rate, rule.ttl().Milliseconds()).Slice()
+		if err != nil {
+			err = fmt.Errorf("run token bucket script error: %w", err)
+			return
+		}
+		if len(v) != 2 {
+			err = fmt.Errorf("unexpected token bucket script result: %v", v)
+			return
+		}
+		res = tokenBucketResult(rule, cast.ToInt(v[0]) == 1, cast.ToFloat64(v[1]))
+	}
+
+	return
+}
@@ -0,0 +1,168 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Body 將資料編碼為 request body，設定在 Request.Body 時會取代 Request.Data
+type Body interface {
+	// Encode 回傳 body 及 Content-Type
+	Encode() (body io.Reader, contentType string, err error)
+}
+
+type jsonBody struct {
+	v any
+}
+
+// JSON 將 v 編碼為 application/json
+func JSON(v any) Body {
+	return jsonBody{v: v}
+}
+
+func (b jsonBody) Encode() (body io.Reader, contentType string, err error) {
+	data, err := json.Marshal(b.v)
+	if err != nil {
+		err = fmt.Errorf("marshal json body error: %s", err.Error())
+		return
+	}
+	return bytes.NewReader(data), "application/json", nil
+}
+
+type formBody struct {
+	values url.Values
+	err    error
+}
+
+// Form 將 values 編碼為 application/x-www-form-urlencoded
+func Form(values url.Values) Body {
+	return formBody{values: values}
+}
+
+// FormStruct 使用 StructToURLValues 將 struct 編碼為 application/x-www-form-urlencoded
+func FormStruct(v any) Body {
+	values, err := StructToURLValues(v)
+	return formBody{values: values, err: err}
+}
+
+func (b formBody) Encode() (body io.Reader, contentType string, err error) {
+	if b.err != nil {
+		err = fmt.Errorf("encode form body error: %s", b.err.Error())
+		return
+	}
+	return strings.NewReader(b.values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+type rawBody struct {
+	data        []byte
+	contentType string
+}
+
+// Raw 直接使用 data 作為 body
+func Raw(data []byte, contentType string) Body {
+	return rawBody{data: data, contentType: contentType}
+}
+
+func (b rawBody) Encode() (body io.Reader, contentType string, err error) {
+	return bytes.NewReader(b.data), b.contentType, nil
+}
+
+// File multipart 中的檔案，Reader 會以串流的方式送出，沒有簽章時不會整個讀進記憶體
+type File struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Reader      io.Reader
+}
+
+type multipartBody struct {
+	fields map[string]string
+	files  []File
+}
+
+// Multipart 將欄位及檔案編碼為 multipart/form-data。
+// 由於檔案是串流送出，這類 request 不會重試。
+// 注意：Client 設定 Signer 時需要計算 body 的 hash，整個 body 會先讀進記憶體，大檔案請不要使用簽章
+func Multipart(fields map[string]string, files ...File) Body {
+	return multipartBody{fields: fields, files: files}
+}
+
+func (b multipartBody) Encode() (body io.Reader, contentType string, err error) {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+
+	body = &pipeBody{
+		pr:    pr,
+		pw:    pw,
+		write: func() error { return b.write(w) },
+	}
+
+	return body, w.FormDataContentType(), nil
+}
+
+// pipeBody 第一次讀取時才開始寫入，request 沒有送出就關閉時不會留下 goroutine
+type pipeBody struct {
+	once  sync.Once
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+	write func() error
+}
+
+func (b *pipeBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go func() {
+			b.pw.CloseWithError(b.write())
+		}()
+	})
+	return b.pr.Read(p)
+}
+
+// Close 開始寫入後關閉時，寫入端會收到 io.ErrClosedPipe 而結束
+func (b *pipeBody) Close() error {
+	b.once.Do(func() {})
+	return b.pr.Close()
+}
+
+func (b multipartBody) write(w *multipart.Writer) (err error) {
+	for k, v := range b.fields {
+		err = w.WriteField(k, v)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, f := range b.files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(f.Field), escapeQuotes(f.Filename)))
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+
+		var part io.Writer
+		part, err = w.CreatePart(h)
+		if err != nil {
+			return
+		}
+
+		_, err = io.Copy(part, f.Reader)
+		if err != nil {
+			return
+		}
+	}
+
+	return w.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
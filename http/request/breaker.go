@@ -0,0 +1,143 @@
+package request
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// BreakerPolicy 每個 host 各自的斷路器設定，FailureThreshold 為 0 時不啟用
+type BreakerPolicy struct {
+	// FailureThreshold 連續失敗幾次後斷路
+	FailureThreshold int
+	// OpenTimeout 斷路多久後進入 half-open 嘗試恢復
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests half-open 時同時允許通過的探測請求數
+	HalfOpenMaxRequests int
+}
+
+type breaker struct {
+	policy BreakerPolicy
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
+
+type hostBreaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	probing  int
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	if policy.OpenTimeout == 0 {
+		policy.OpenTimeout = 30 * time.Second
+	}
+	if policy.HalfOpenMaxRequests == 0 {
+		policy.HalfOpenMaxRequests = 1
+	}
+
+	return &breaker{
+		policy: policy,
+		hosts:  map[string]*hostBreaker{},
+	}
+}
+
+func (b *breaker) enabled() bool {
+	return b.policy.FailureThreshold > 0
+}
+
+// allow 檢查是否可以對 host 發送請求
+func (b *breaker) allow(host string) bool {
+	if !b.enabled() {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.get(host)
+	switch h.state {
+	case breakerOpen:
+		if time.Since(h.openedAt) < b.policy.OpenTimeout {
+			return false
+		}
+		b.setState(host, h, breakerHalfOpen)
+		h.probing = 1
+		return true
+	case breakerHalfOpen:
+		if h.probing >= b.policy.HalfOpenMaxRequests {
+			return false
+		}
+		h.probing++
+		return true
+	}
+
+	return true
+}
+
+// done 記錄請求的結果
+func (b *breaker) done(host string, success bool) {
+	if !b.enabled() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.get(host)
+	if h.state == breakerHalfOpen && h.probing > 0 {
+		h.probing--
+	}
+
+	if success {
+		h.failures = 0
+		if h.state != breakerClosed {
+			b.setState(host, h, breakerClosed)
+		}
+		return
+	}
+
+	h.failures++
+	if h.state == breakerHalfOpen || h.failures >= b.policy.FailureThreshold {
+		h.openedAt = time.Now()
+		if h.state != breakerOpen {
+			b.setState(host, h, breakerOpen)
+		}
+	}
+}
+
+// release 結束請求但不計入結果，用在呼叫端自己取消的請求
+func (b *breaker) release(host string) {
+	if !b.enabled() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.get(host)
+	if h.state == breakerHalfOpen && h.probing > 0 {
+		h.probing--
+	}
+}
+
+func (b *breaker) get(host string) *hostBreaker {
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &hostBreaker{state: breakerClosed}
+		b.hosts[host] = h
+	}
+	return h
+}
+
+func (b *breaker) setState(host string, h *hostBreaker, state string) {
+	h.state = state
+	metrics.Add("breaker_"+state+"."+host, 1)
+}
@@ -0,0 +1,135 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+// RemoteError 內部服務回傳的 status.code 不是 syserrno.OK 時的原始錯誤，
+// 會被包裝在 Call 回傳的 catch 錯誤中，可以用 errors.As 取出
+type RemoteError struct {
+	URL        string // 已遮蔽敏感 query 參數
+	HTTPStatus int
+	Status     response.Status
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("call %s error, http status: %d, code: %s, message: %s, traceCode: %s", e.URL, e.HTTPStatus, e.Status.Code, e.Status.Message, e.Status.TraceCode)
+}
+
+// RemoteTraceCode 取出 Call 回傳的錯誤中遠端服務的 traceCode，用來查詢遠端的 log，不是遠端錯誤時回傳空值
+func RemoteTraceCode(err error) string {
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		return remote.Status.TraceCode
+	}
+	return ""
+}
+
+type envelope struct {
+	Data   jsoniter.RawMessage `json:"data"`
+	Status response.Status     `json:"status"`
+}
+
+// Call 使用 Default() 的 Client 呼叫回傳 response.Response 格式的內部服務，並將 data 解析為 T。
+// 遠端回傳的 status.code 不是 syserrno.OK 時，會回傳保留遠端錯誤代碼及訊息的 catch 錯誤，
+// gateway 可以直接回傳或使用 catch.ReplaceOutPutMsg 替換訊息，遠端的 traceCode 可以用 RemoteTraceCode 取出
+//
+// example:
+//
+//	user, err := request.Call[User](http.MethodGet, &request.Request{
+//		URL:           "http://member:8080/member/user",
+//		Data:          request.StructToURLQueryString(req),
+//		CTX:           ctx,
+//		DefaultHeader: true,
+//	})
+func Call[T any](method string, r *Request) (data T, err error) {
+	return CallWith[T](Default(), method, r)
+}
+
+// CallWith 與 Call 相同，但使用指定的 Client
+func CallWith[T any](c *Client, method string, r *Request) (data T, err error) {
+	req, cancel, err := c.newRequest(method, r)
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	j := newJournal(r, req)
+	resp, retries, err := c.send(parentContext(r), req)
+	remoteCode := ""
+	defer func() {
+		j.done(resp, retries, remoteCode, err)
+	}()
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(j.capture(resp.Body))
+	if err != nil {
+		err = catch.Wrap(err, syserrno.HTTP, callUpstreamError, fmt.Sprintf("call %s error, read response body error: %s", redactURL(req.URL), err.Error()))
+		return
+	}
+
+	env := envelope{}
+	err = json.Unmarshal(b, &env)
+	if err != nil || env.Status.Code == "" {
+		if err == nil {
+			err = fmt.Errorf("missing status in response")
+		}
+		err = catch.Wrap(
+			err,
+			syserrno.HTTP,
+			callUpstreamError,
+			fmt.Sprintf("call %s error, http status: %d, body: %s, err: %s", redactURL(req.URL), resp.StatusCode, truncate(b, 1024), err.Error()),
+		)
+		return
+	}
+
+	remoteCode = env.Status.Code
+	if env.Status.Code != syserrno.OK {
+		remote := &RemoteError{
+			URL:        redactURL(req.URL),
+			HTTPStatus: resp.StatusCode,
+			Status:     env.Status,
+		}
+		err = catch.Wrap(remote, env.Status.Code, env.Status.Message, remote.Error())
+		return
+	}
+
+	if len(env.Data) == 0 || string(env.Data) == "null" {
+		return
+	}
+
+	err = json.Unmarshal(env.Data, &data)
+	if err != nil && string(env.Data) == `"Success"` {
+		// 沒有 data 時 response.OK 會回傳 "Success"，T 不是字串時視為沒有 data
+		err = nil
+		return
+	}
+	if err != nil {
+		err = catch.Wrap(
+			err,
+			syserrno.HTTP,
+			callUpstreamError,
+			fmt.Sprintf("call %s error, unmarshal data error, data: %s, err: %s", redactURL(req.URL), truncate(env.Data, 1024), err.Error()),
+		)
+		return
+	}
+
+	return
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return string(b[:n]) + "..."
+}
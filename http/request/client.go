@@ -0,0 +1,314 @@
+package request
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/sign"
+)
+
+// ClientConfig 對外呼叫 http 時的連線設定，零值的欄位會使用 DefaultClientConfig 的值
+type ClientConfig struct {
+	// Timeout 單次呼叫（含讀取 body）的時間上限
+	Timeout time.Duration
+	// Targets 針對特定 host（如 `order:8080`）的 Timeout
+	Targets map[string]time.Duration
+
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	DisableKeepAlives     bool
+
+	// TLS
+	InsecureSkipVerify bool
+	// CAFile 自簽憑證的 CA，空值時使用系統的 CA
+	CAFile string
+	// CertFile, KeyFile mTLS 使用的 client 憑證
+	CertFile string
+	KeyFile  string
+
+	Retry   RetryPolicy
+	Breaker BreakerPolicy
+
+	// Signer 有值時 DefaultHeader 的 request 改以簽章（參考 http/sign）取代 SysToken
+	Signer *sign.Signer
+
+	// Transport 有值時取代依照上述設定建立的 transport，測試時用來注入 requesttest 的 Recorder 或 stub server
+	Transport http.RoundTripper
+}
+
+// Client 可重複使用的 http client，連線會在多次呼叫間共用
+type Client struct {
+	conf    ClientConfig
+	client  *http.Client
+	breaker *breaker
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultClient = mustNewClient(DefaultClientConfig())
+)
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Timeout:             30 * time.Second,
+		DialTimeout:         3 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+	}
+}
+
+func mustNewClient(conf ClientConfig) *Client {
+	c, err := NewClient(conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return c
+}
+
+// NewClient 依照設定建立 Client
+func NewClient(conf ClientConfig) (c *Client, err error) {
+	def := DefaultClientConfig()
+	if conf.Timeout == 0 {
+		conf.Timeout = def.Timeout
+	}
+	if conf.DialTimeout == 0 {
+		conf.DialTimeout = def.DialTimeout
+	}
+	if conf.KeepAlive == 0 {
+		conf.KeepAlive = def.KeepAlive
+	}
+	if conf.TLSHandshakeTimeout == 0 {
+		conf.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+	if conf.IdleConnTimeout == 0 {
+		conf.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if conf.MaxIdleConns == 0 {
+		conf.MaxIdleConns = def.MaxIdleConns
+	}
+	if conf.MaxIdleConnsPerHost == 0 {
+		conf.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+
+	conf.Retry = conf.Retry.withDefault()
+
+	c = &Client{
+		conf:    conf,
+		breaker: newBreaker(conf.Breaker),
+	}
+
+	if conf.Transport != nil {
+		c.client = &http.Client{Transport: conf.Transport}
+		return
+	}
+
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		c = nil
+		return
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   conf.DialTimeout,
+			KeepAlive: conf.KeepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   conf.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+		IdleConnTimeout:       conf.IdleConnTimeout,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		DisableKeepAlives:     conf.DisableKeepAlives,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	// timeout 改由 context 控制，才能針對不同 target 設定
+	c.client = &http.Client{Transport: transport}
+
+	return
+}
+
+func newTLSConfig(conf ClientConfig) (res *tls.Config, err error) {
+	res = &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if conf.CAFile != "" {
+		var b []byte
+		b, err = os.ReadFile(conf.CAFile)
+		if err != nil {
+			err = fmt.Errorf("read ca file `%s` error: %s", conf.CAFile, err.Error())
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			err = fmt.Errorf("parse ca file `%s` error", conf.CAFile)
+			return
+		}
+		res.RootCAs = pool
+	}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			err = fmt.Errorf("load client certificate error: %s", err.Error())
+			return
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return
+}
+
+// GetClient 從 consul 載入設定並建立 Client，沒有設定的欄位使用預設值
+//
+// 假設 consul 路徑 "/system/http_client" 內有下列資料
+// `
+//
+//	timeout = "10s"
+//	dial_timeout = "3s"
+//	keep_alive = "30s"
+//	tls_handshake_timeout = "5s"
+//	response_header_timeout = "5s"
+//	idle_conn_timeout = "90s"
+//	max_idle_conns = 100
+//	max_idle_conns_per_host = 10
+//	max_conns_per_host = 0
+//	disable_keep_alives = false
+//	insecure_skip_verify = false
+//	ca_file = "/etc/ssl/internal-ca.pem"
+//	cert_file = ""
+//	key_file = ""
+//	sign = true
+//	[retry]
+//	max_retries = 2
+//	base_delay = "100ms"
+//	max_delay = "2s"
+//	retry_on = "429,502,503,504"
+//	[breaker]
+//	failure_threshold = 5
+//	open_timeout = "30s"
+//	half_open_max_requests = 1
+//	[targets]
+//	order = { host = "order:8080", timeout = "3s" }
+//
+// `
+//
+// request.SetDefault(request.GetClient("/system/http_client"))
+func GetClient(path string) (c *Client) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Fatalf("get http client error: %s \n - path %s", err, path)
+		}
+	}()
+
+	v, err := config.GetValues(path, false)
+	if err != nil {
+		return
+	}
+
+	conf := ClientConfig{}
+	conf.Timeout, _ = v.Duration("timeout")
+	conf.DialTimeout, _ = v.Duration("dial_timeout")
+	conf.KeepAlive, _ = v.Duration("keep_alive")
+	conf.TLSHandshakeTimeout, _ = v.Duration("tls_handshake_timeout")
+	conf.ResponseHeaderTimeout, _ = v.Duration("response_header_timeout")
+	conf.IdleConnTimeout, _ = v.Duration("idle_conn_timeout")
+	conf.MaxIdleConns = v.Int("max_idle_conns")
+	conf.MaxIdleConnsPerHost = v.Int("max_idle_conns_per_host")
+	conf.MaxConnsPerHost = v.Int("max_conns_per_host")
+	conf.DisableKeepAlives = v.Bool("disable_keep_alives")
+	conf.InsecureSkipVerify = v.Bool("insecure_skip_verify")
+	conf.CAFile = v.String("ca_file")
+	conf.CertFile = v.String("cert_file")
+	conf.KeyFile = v.String("key_file")
+
+	// 需要先呼叫 sign.Init 載入金鑰
+	if v.Bool("sign") {
+		conf.Signer = sign.NewSigner(basic.ServerName, sign.Keys)
+	}
+
+	retry := v.Section("retry")
+	conf.Retry.MaxRetries = retry.Int("max_retries")
+	conf.Retry.BaseDelay, _ = retry.Duration("base_delay")
+	conf.Retry.MaxDelay, _ = retry.Duration("max_delay")
+	for _, status := range retry.Strings("retry_on") {
+		conf.Retry.RetryOn = append(conf.Retry.RetryOn, cast.ToInt(status))
+	}
+
+	breaker := v.Section("breaker")
+	conf.Breaker.FailureThreshold = breaker.Int("failure_threshold")
+	conf.Breaker.OpenTimeout, _ = breaker.Duration("open_timeout")
+	conf.Breaker.HalfOpenMaxRequests = breaker.Int("half_open_max_requests")
+
+	conf.Targets = map[string]time.Duration{}
+	targets := v.Section("targets")
+	for k := range targets {
+		// k example: order.host
+		name, found := strings.CutSuffix(k, ".host")
+		if !found {
+			continue
+		}
+
+		host := targets.String(k)
+		timeout, _ := targets.Duration(name + ".timeout")
+		if host == "" || timeout == 0 {
+			continue
+		}
+		conf.Targets[host] = timeout
+	}
+
+	c, err = NewClient(conf)
+
+	return
+}
+
+// Default 回傳套件層級 GET/POST/PUT/PATCH/DELETE 使用的 Client
+func Default() *Client {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultClient
+}
+
+// SetDefault 替換套件層級 GET/POST/PUT/PATCH/DELETE 使用的 Client
+func SetDefault(c *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = c
+}
+
+// timeout 取得呼叫 host 時使用的 timeout
+func (c *Client) timeout(host string) time.Duration {
+	if t, ok := c.conf.Targets[host]; ok {
+		return t
+	}
+	return c.conf.Timeout
+}
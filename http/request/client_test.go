@@ -0,0 +1,261 @@
+package request_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/win30221/core/basic"
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/request"
+	"github.com/win30221/core/http/request/requesttest"
+	"github.com/win30221/core/syserrno"
+)
+
+func init() {
+	basic.TimeZone = time.UTC
+}
+
+func newClient(t *testing.T, conf request.ClientConfig) *request.Client {
+	if conf.Timeout == 0 {
+		conf.Timeout = time.Second
+	}
+	c, err := request.NewClient(conf)
+	if err != nil {
+		t.Fatalf("new client error: %v", err)
+	}
+	return c
+}
+
+// sequence 依序回傳 statuses，用完後一直回傳最後一個
+func sequence(statuses ...int) http.HandlerFunc {
+	var mu sync.Mutex
+	i := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := statuses[min(i, len(statuses)-1)]
+		i++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		code := syserrno.OK
+		if status != http.StatusOK {
+			code = "123456"
+		}
+		io.WriteString(w, `{"data":{"name":"bob"},"status":{"code":"`+code+`","message":"msg","traceCode":"remote-trace"}}`)
+	}
+}
+
+func errorCode(err error) string {
+	e, _ := catch.CheckCustomError(err)
+	return e.Code
+}
+
+func TestClient_retry(t *testing.T) {
+	retry := request.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		method    string
+		header    http.Header
+		statuses  []int
+		wantCalls int
+		wantCode  string
+	}{
+		{name: "success after retry", method: http.MethodGet, statuses: []int{503, 200}, wantCalls: 2},
+		{name: "retries exhausted on status", method: http.MethodGet, statuses: []int{503}, wantCalls: 3, wantCode: syserrno.HTTPRetryExhausted},
+		{name: "not retryable status", method: http.MethodGet, statuses: []int{500}, wantCalls: 1},
+		{name: "post without idempotency key", method: http.MethodPost, statuses: []int{503, 200}, wantCalls: 1},
+		{name: "post with idempotency key", method: http.MethodPost, header: http.Header{consts.HeaderIdempotencyKey: {"k1"}}, statuses: []int{503, 200}, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := requesttest.NewServer().Handle(tt.method, "/a", sequence(tt.statuses...)).Start()
+			defer srv.Close()
+
+			c := newClient(t, request.ClientConfig{Retry: retry})
+			err := c.Do(tt.method, &request.Request{URL: srv.URL + "/a", Header: tt.header, CTX: ctx.NewEmpty()})
+
+			if got := srv.Calls(tt.method, "/a"); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+			if got := errorCode(err); got != tt.wantCode {
+				t.Errorf("error code = %q, want %q (err: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestClient_retryRewindsBody(t *testing.T) {
+	var mu sync.Mutex
+	bodies := []string{}
+	statuses := sequence(503, 200)
+
+	srv := requesttest.NewServer().Handle(http.MethodPut, "/a", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		statuses(w, r)
+	}).Start()
+	defer srv.Close()
+
+	c := newClient(t, request.ClientConfig{Retry: request.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}})
+	err := c.PUT(&request.Request{URL: srv.URL + "/a", Body: request.JSON(map[string]string{"name": "bob"}), CTX: ctx.NewEmpty()})
+	if err != nil {
+		t.Fatalf("PUT error: %v", err)
+	}
+
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[0] == "" {
+		t.Errorf("bodies = %q, want the same body twice", bodies)
+	}
+}
+
+func TestClient_breaker(t *testing.T) {
+	srv := requesttest.NewServer().Handle(http.MethodGet, "/a", sequence(500, 500, 200)).Start()
+	defer srv.Close()
+
+	c := newClient(t, request.ClientConfig{Breaker: request.BreakerPolicy{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}})
+	call := func() error {
+		return c.GET(&request.Request{URL: srv.URL + "/a", CTX: ctx.NewEmpty()})
+	}
+
+	call()
+	call()
+
+	// 連續失敗後斷路，不會呼叫到 server
+	if err := call(); errorCode(err) != syserrno.HTTPCircuitOpen {
+		t.Fatalf("error = %v, want circuit open", err)
+	}
+	if got := srv.Calls(http.MethodGet, "/a"); got != 2 {
+		t.Fatalf("calls = %d, want 2", got)
+	}
+
+	// half-open 的探測成功後恢復
+	time.Sleep(60 * time.Millisecond)
+	if err := call(); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if err := call(); err != nil {
+		t.Errorf("call after recovery error = %v", err)
+	}
+	if got := srv.Calls(http.MethodGet, "/a"); got != 4 {
+		t.Errorf("calls = %d, want 4", got)
+	}
+}
+
+func TestClient_breakerIgnoresCallerCancel(t *testing.T) {
+	srv := requesttest.NewServer().Handle(http.MethodGet, "/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}).OK(http.MethodGet, "/a", nil).Start()
+	defer srv.Close()
+
+	c := newClient(t, request.ClientConfig{Breaker: request.BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Hour}})
+
+	parent, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.GET(&request.Request{URL: srv.URL + "/slow", CTX: ctx.FromContext(parent)}); err == nil {
+		t.Fatal("slow call error = nil, want deadline exceeded")
+	}
+
+	if err := c.GET(&request.Request{URL: srv.URL + "/a", CTX: ctx.NewEmpty()}); err != nil {
+		t.Errorf("call after caller timeout error = %v, want breaker still closed", err)
+	}
+}
+
+func TestCallWith(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	srv := requesttest.NewServer().
+		OK(http.MethodGet, "/user", user{Name: "bob"}).
+		OK(http.MethodPost, "/user", nil).
+		Handle(http.MethodGet, "/fail", sequence(400)).
+		Start()
+	defer srv.Close()
+
+	c := newClient(t, request.ClientConfig{})
+
+	u, err := request.CallWith[user](c, http.MethodGet, &request.Request{URL: srv.URL + "/user", CTX: ctx.NewEmpty()})
+	if err != nil || u.Name != "bob" {
+		t.Errorf("CallWith() = %+v, %v, want bob", u, err)
+	}
+
+	u, err = request.CallWith[user](c, http.MethodPost, &request.Request{URL: srv.URL + "/user", CTX: ctx.NewEmpty()})
+	if err != nil || u.Name != "" {
+		t.Errorf("CallWith() without data = %+v, %v, want zero value", u, err)
+	}
+
+	_, err = request.CallWith[user](c, http.MethodGet, &request.Request{URL: srv.URL + "/fail", Data: "token=secret-value", CTX: ctx.NewEmpty()})
+	if errorCode(err) != "123456" || request.RemoteTraceCode(err) != "remote-trace" {
+		t.Errorf("CallWith() error = %v, want remote code and trace code", err)
+	}
+	var remote *request.RemoteError
+	if !errors.As(err, &remote) || strings.Contains(remote.URL, "secret-value") {
+		t.Errorf("remote error = %+v, want redacted url", remote)
+	}
+}
+
+func TestClient_journalRedactsURL(t *testing.T) {
+	srv := requesttest.NewServer().Handle(http.MethodGet, "/a", sequence(503)).Start()
+	defer srv.Close()
+
+	c := newClient(t, request.ClientConfig{Retry: request.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}})
+	rc := ctx.NewEmpty()
+	err := c.GET(&request.Request{URL: srv.URL + "/a", Data: "token=secret-value&id=1", CTX: rc})
+	if err == nil {
+		t.Fatal("GET error = nil, want retries exhausted")
+	}
+
+	e, _ := catch.CheckCustomError(err)
+	if strings.Contains(e.OutputMsg, srv.URL) || strings.Contains(e.LogMsg, "secret-value") {
+		t.Errorf("error leaks the url: %+v", e)
+	}
+
+	logs, _ := rc.Get(consts.KeyHTTPLogs)
+	entries, _ := logs.([]any)
+	if len(entries) != 1 {
+		t.Fatalf("http logs = %v, want 1 entry", logs)
+	}
+	entry := entries[0].(request.CallLog)
+	if entry.Retries != 1 || strings.Contains(entry.URL, "secret-value") || strings.Contains(entry.Error, "secret-value") {
+		t.Errorf("call log = %+v, want redacted url and error", entry)
+	}
+	if !strings.HasPrefix(entry.Error, syserrno.HTTPRetryExhausted+": ") || strings.Contains(entry.Error, e.Stack) {
+		t.Errorf("call log error = %q, want code and log message without stack", entry.Error)
+	}
+}
+
+func TestClient_journalRedactsTransportError(t *testing.T) {
+	srv := requesttest.NewServer().Start()
+	url := srv.URL
+	srv.Close()
+
+	c := newClient(t, request.ClientConfig{})
+	rc := ctx.NewEmpty()
+	if err := c.GET(&request.Request{URL: url + "/a", Data: "token=secret-value", CTX: rc}); err == nil {
+		t.Fatal("GET error = nil, want connection error")
+	}
+
+	logs, _ := rc.Get(consts.KeyHTTPLogs)
+	entries, _ := logs.([]any)
+	if len(entries) != 1 {
+		t.Fatalf("http logs = %v, want 1 entry", logs)
+	}
+	if entry := entries[0].(request.CallLog); entry.Error == "" || strings.Contains(entry.Error, "secret-value") {
+		t.Errorf("call log error = %q, want redacted error", entry.Error)
+	}
+}
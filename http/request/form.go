@@ -0,0 +1,267 @@
+package request
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// StructToURLQueryString 將 struct 轉為 query string，規則與 gin 的 form binding 相同，
+// 詳細規則請參考 StructToURLValues。轉換失敗的欄位會被略過
+func StructToURLQueryString(data any) (res string) {
+	values, _ := StructToURLValues(data)
+	res = values.Encode()
+	return
+}
+
+// StructToURLValues 將 struct 轉為 url.Values，產生的結果經由 callee 的 c.ShouldBindQuery/ShouldBind 解析後會得到相同的值
+//
+//   - 欄位名稱使用 form tag，沒有 tag 時使用欄位名稱，`form:"-"` 會被略過
+//   - 零值（false, 0, ""）也會輸出，tag 加上 omitempty（如 `form:"name,omitempty"`）時才會略過
+//   - nil 的指標、slice、map 會被略過
+//   - embedded struct 及沒有 tag 的 struct 欄位會展開
+//   - 有 tag 的 struct 欄位、map 及實作 encoding.TextMarshaler 的 struct 會轉為 JSON
+//   - time.Time 依照 time_format、time_utc、time_location tag 輸出，預設為 RFC3339
+//   - time.Duration 輸出為 `1m30s` 的格式
+//   - slice 及 array 會輸出多個相同名稱的參數
+//   - 傳入 map[string]string、map[string][]string 或 map[string]any 時直接使用 key 作為參數名稱
+func StructToURLValues(data any) (values url.Values, err error) {
+	values = url.Values{}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		err = encodeStruct(values, v)
+	case reflect.Map:
+		err = encodeMap(values, v)
+	default:
+		err = fmt.Errorf("unsupported type %s, only struct and map[string]... allowed", v.Type())
+	}
+
+	return
+}
+
+func encodeMap(values url.Values, v reflect.Value) (err error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+	}
+
+	iter := v.MapRange()
+	for iter.Next() {
+		err = encodeValue(values, iter.Key().String(), iter.Value(), reflect.StructField{})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func encodeStruct(values url.Values, v reflect.Value) (err error) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+
+		tag := sf.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		omitempty := hasOption(opts, "omitempty")
+
+		field := v.Field(i)
+		if omitempty && field.IsZero() {
+			continue
+		}
+
+		// 指標及 interface 取出實際的值，nil 時略過
+		for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+			if field.IsNil() {
+				break
+			}
+			field = field.Elem()
+		}
+		if (field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface) && field.IsNil() {
+			continue
+		}
+
+		// gin 遇到 embedded struct 或找不到名稱對應的參數時，會以相同的 form 展開 struct 內的欄位
+		if field.Kind() == reflect.Struct && !isScalarStruct(field.Type()) && (sf.Anonymous || name == "") {
+			err = encodeStruct(values, field)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" { // unexported 的 embedded 非 struct 型別
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		err = encodeValue(values, name, field, sf)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func encodeValue(values url.Values, name string, v reflect.Value, sf reflect.StructField) (err error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			var s string
+			s, err = formatValue(v.Index(i), sf)
+			if err != nil {
+				return
+			}
+			values.Add(name, s)
+		}
+		return
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+	}
+
+	s, err := formatValue(v, sf)
+	if err != nil {
+		return
+	}
+	values.Add(name, s)
+
+	return
+}
+
+// formatValue 依照 gin 的 setWithProperType 反向轉換單一值
+func formatValue(v reflect.Value, sf reflect.StructField) (res string, err error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		res = formatTime(v.Interface().(time.Time), sf)
+		return
+	}
+
+	if v.Type() == durationType {
+		res = time.Duration(v.Int()).String()
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		res = v.String()
+	case reflect.Bool:
+		res = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		res = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		res = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		res = strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		res = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Struct, reflect.Map:
+		// gin 以 json.Unmarshal 解析 struct 及 map，實作 encoding.TextMarshaler 的型別也會經由 JSON 轉為字串
+		var b []byte
+		b, err = json.Marshal(v.Interface())
+		if err != nil {
+			err = fmt.Errorf("marshal %s error: %s", v.Type(), err.Error())
+			return
+		}
+		res = string(b)
+	default:
+		err = fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return
+}
+
+// formatTime 與 gin 的 setTimeField 對應
+func formatTime(t time.Time, sf reflect.StructField) string {
+	layout := sf.Tag.Get("time_format")
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	switch strings.ToLower(layout) {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixnano":
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+
+	if t.IsZero() {
+		return ""
+	}
+
+	if isUTC, _ := strconv.ParseBool(sf.Tag.Get("time_utc")); isUTC {
+		t = t.UTC()
+	}
+
+	if locTag := sf.Tag.Get("time_location"); locTag != "" {
+		if loc, err := time.LoadLocation(locTag); err == nil {
+			t = t.In(loc)
+		}
+	}
+
+	return t.Format(layout)
+}
+
+// isScalarStruct 以單一值輸出而不展開的 struct
+func isScalarStruct(t reflect.Type) bool {
+	return t == timeType || t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package request
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+type formLevel int
+
+type formPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type formPaging struct {
+	Page int `form:"page"`
+	Size int `form:"size,default=20"`
+}
+
+type formQuery struct {
+	formPaging
+
+	Name     string    `form:"name"`
+	Enabled  bool      `form:"enabled"`
+	Count    int       `form:"count"`
+	Ratio    float64   `form:"ratio"`
+	Level    formLevel `form:"level"`
+	Untagged string
+	Skip     string            `form:"-"`
+	Optional *int              `form:"optional"`
+	Missing  *string           `form:"missing"`
+	Tags     []string          `form:"tags"`
+	IDs      [2]uint           `form:"ids"`
+	Point    formPoint         `form:"point"`
+	Labels   map[string]string `form:"labels"`
+	Timeout  time.Duration     `form:"timeout"`
+	Created  time.Time         `form:"created" time_utc:"1"`
+	Day      time.Time         `form:"day" time_format:"2006-01-02" time_utc:"1"`
+	Unix     time.Time         `form:"unix" time_format:"unix"`
+	Nested   struct {
+		City string `form:"city"`
+	}
+}
+
+func bindQuery(t *testing.T, values url.Values, out any) {
+	req, _ := http.NewRequest(http.MethodGet, "/?"+values.Encode(), nil)
+	if err := binding.Query.Bind(req, out); err != nil {
+		t.Fatalf("bind error: %v, query: %s", err, values.Encode())
+	}
+}
+
+func Test_StructToURLValues_RoundTrip(t *testing.T) {
+	optional := 0
+	in := formQuery{
+		formPaging: formPaging{Page: 0, Size: 0},
+		Name:       "",
+		Enabled:    false,
+		Count:      0,
+		Ratio:      0.25,
+		Level:      3,
+		Untagged:   "untagged",
+		Skip:       "skip",
+		Optional:   &optional,
+		Tags:       []string{"a", "b,c", ""},
+		IDs:        [2]uint{1, 2},
+		Point:      formPoint{X: 1, Y: 2},
+		Labels:     map[string]string{"env": "prod"},
+		Timeout:    90 * time.Second,
+		Created:    time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Day:        time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+		Unix:       time.Unix(1700000000, 0),
+	}
+	in.Nested.City = "taipei"
+
+	values, err := StructToURLValues(&in)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	for _, key := range []string{"name", "enabled", "count", "page", "size"} {
+		if _, ok := values[key]; !ok {
+			t.Errorf("zero value %s dropped, query: %s", key, values.Encode())
+		}
+	}
+
+	out := formQuery{}
+	bindQuery(t, values, &out)
+
+	want := in
+	want.Skip = ""
+	if !out.Unix.Equal(want.Unix) {
+		t.Errorf("unix: %v, want: %v", out.Unix, want.Unix)
+	}
+	out.Unix, want.Unix = time.Time{}, time.Time{}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("round trip mismatch\n got: %+v\nwant: %+v\nquery: %s", out, want, values.Encode())
+	}
+}
+
+func Test_StructToURLValues_OmitEmpty(t *testing.T) {
+	type query struct {
+		Name  string `form:"name,omitempty"`
+		Page  int    `form:"page,omitempty,default=1"`
+		Limit int    `form:"limit,default=10"`
+	}
+
+	values, err := StructToURLValues(query{})
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	if got := values.Encode(); got != "limit=0" {
+		t.Fatalf("query: %s, want: limit=0", got)
+	}
+
+	// omitempty 的欄位由 callee 的 default 決定
+	out := query{}
+	bindQuery(t, values, &out)
+	if out != (query{Page: 1, Limit: 0}) {
+		t.Errorf("result: %+v", out)
+	}
+}
+
+func Test_StructToURLValues_TextMarshaler(t *testing.T) {
+	type query struct {
+		At *time.Time `form:"at"`
+		IP formIP     `form:"ip"`
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	in := query{At: &at, IP: formIP{1, 2, 3, 4}}
+
+	values, err := StructToURLValues(in)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	out := query{}
+	bindQuery(t, values, &out)
+	if out.At == nil || !out.At.Equal(at) || out.IP != in.IP {
+		t.Errorf("result: %+v, query: %s", out, values.Encode())
+	}
+}
+
+func Test_StructToURLValues_Map(t *testing.T) {
+	values, err := StructToURLValues(map[string]any{"a": 1, "b": []string{"x", "y"}, "c": false})
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	if got := values.Encode(); got != "a=1&b=x&b=y&c=false" {
+		t.Errorf("query: %s", got)
+	}
+
+	if _, err = StructToURLValues(1); err == nil {
+		t.Errorf("expect error for non struct")
+	}
+
+	if got := StructToURLQueryString((*formQuery)(nil)); got != "" {
+		t.Errorf("nil pointer query: %s", got)
+	}
+}
+
+// formIP 實作 encoding.TextMarshaler 的 struct
+type formIP struct {
+	A, B, C, D byte
+}
+
+func (ip formIP) MarshalText() ([]byte, error) {
+	return []byte(string(rune('0'+ip.A)) + "." + string(rune('0'+ip.B)) + "." + string(rune('0'+ip.C)) + "." + string(rune('0'+ip.D))), nil
+}
+
+func (ip *formIP) UnmarshalText(b []byte) error {
+	if len(b) != 7 {
+		return nil
+	}
+	ip.A, ip.B, ip.C, ip.D = b[0]-'0', b[2]-'0', b[4]-'0', b[6]-'0'
+	return nil
+}
@@ -0,0 +1,146 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// journalBodyLimit 記錄 request/response body 的長度上限
+const journalBodyLimit = 2048
+
+// sensitiveQueryKeys query string 中包含這些字的參數會被遮蔽
+var sensitiveQueryKeys = []string{"token", "password", "passwd", "secret", "signature", "sign", "apikey", "api_key", "access_key"}
+
+// CallLog 單次對外呼叫的紀錄，會跟 sqlLogs 一起在 access log 中輸出
+type CallLog struct {
+	Method     string        `json:"method"`
+	URL        string        `json:"url"`
+	Status     int           `json:"status"`
+	Latency    time.Duration `json:"latency"`
+	RemoteCode string        `json:"remoteCode,omitempty"`
+	Retries    int           `json:"retries"`
+	Error      string        `json:"error,omitempty"`
+	// RequestBody, ResponseBody 只有在 log_mode 為 debug 時才會記錄
+	RequestBody  string `json:"requestBody,omitempty"`
+	ResponseBody string `json:"responseBody,omitempty"`
+}
+
+// journal 紀錄一次對外呼叫
+type journal struct {
+	r       *Request
+	req     *http.Request
+	start   time.Time
+	debug   bool
+	reqBody string
+	resp    *cappedBuffer
+}
+
+func newJournal(r *Request, req *http.Request) (j *journal) {
+	j = &journal{
+		r:     r,
+		req:   req,
+		start: time.Now(),
+		debug: zap.L().Core().Enabled(zapcore.DebugLevel),
+	}
+
+	if j.debug && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(body, journalBodyLimit+1))
+			body.Close()
+			j.reqBody = truncate(b, journalBodyLimit)
+		}
+	}
+
+	return
+}
+
+// capture 在 debug 時記錄 response body，回傳的 reader 需取代原本的 resp.Body 讀取
+func (j *journal) capture(body io.Reader) io.Reader {
+	if !j.debug {
+		return body
+	}
+
+	j.resp = &cappedBuffer{limit: journalBodyLimit}
+	return io.TeeReader(body, j.resp)
+}
+
+func (j *journal) done(resp *http.Response, retries int, remoteCode string, err error) {
+	if j.r.CTX == nil {
+		return
+	}
+
+	entry := CallLog{
+		Method:      j.req.Method,
+		URL:         redactURL(j.req.URL),
+		Latency:     time.Since(j.start),
+		RemoteCode:  remoteCode,
+		Retries:     retries,
+		RequestBody: j.reqBody,
+	}
+
+	if resp != nil {
+		entry.Status = resp.StatusCode
+	}
+
+	if err != nil {
+		entry.Error = journalError(err)
+	}
+
+	if j.resp != nil {
+		entry.ResponseBody = truncate(j.resp.Bytes(), journalBodyLimit)
+	}
+
+	j.r.CTX.Append(consts.KeyHTTPLogs, entry)
+}
+
+// journalError 記錄錯誤代碼及已遮蔽 URL 的 LogMsg，err.Error() 會包含原始 URL 與 stack，不能直接寫入 log
+func journalError(err error) string {
+	if e, ok := catch.CheckCustomError(err); ok {
+		return e.Code + ": " + e.LogMsg
+	}
+	return errorText(err)
+}
+
+// redactURL 移除 URL 中的帳密及敏感的 query 參數
+func redactURL(u *url.URL) string {
+	res := *u
+	query := res.Query()
+	for k := range query {
+		lower := strings.ToLower(k)
+		for _, s := range sensitiveQueryKeys {
+			if strings.Contains(lower, s) {
+				query.Set(k, "xxxxx")
+				break
+			}
+		}
+	}
+	res.RawQuery = query.Encode()
+
+	return res.Redacted()
+}
+
+// cappedBuffer 只保留前 limit 個 byte 的 buffer
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if remain := b.limit + 1 - b.Len(); remain > 0 {
+		if len(p) > remain {
+			p = p[:remain]
+		}
+		b.Buffer.Write(p)
+	}
+	return
+}
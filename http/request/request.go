@@ -1,10 +1,13 @@
 package request
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,210 +21,378 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// callUpstreamError 回傳給 client 的訊息，URL 可能帶有內部的 host 及 query 中的機密，只記錄在 log
+const callUpstreamError = "call upstream error"
+
 type Request struct {
-	URL    string
-	Data   string
+	URL  string
+	Data string
+	// Body 有值時取代 Data，可使用 JSON, Form, FormStruct, Multipart, Raw
+	Body   Body
 	Result any
 	CTX    *ctx.Context
 	// header
 	Header        http.Header
 	DefaultHeader bool
+	// Timeout 為 0 時使用 Client 的設定
+	Timeout time.Duration
 }
 
-func StructToURLQueryString(data interface{}) (res string) {
-	values := url.Values{}
+// GET 使用 Default() 的 Client 呼叫，r.Data 會作為 query string
+func GET(r *Request) (err error) {
+	return Default().GET(r)
+}
 
-	val := reflect.ValueOf(data)
-	typ := reflect.TypeOf(data)
+func POST(r *Request) (err error) {
+	return Default().POST(r)
+}
 
-	// 阻擋傳入非 struct 的型別
-	if val.Kind() != reflect.Struct {
-		return
-	}
+func PUT(r *Request) (err error) {
+	return Default().PUT(r)
+}
 
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Field(i)
-		structField := typ.Field(i)
-		tag := structField.Tag.Get("form")
-		if tag == "-" || tag == "" || field.IsZero() || !field.CanInterface() {
-			continue
-		}
+func PATCH(r *Request) (err error) {
+	return Default().PATCH(r)
+}
 
-		// 處理空值
-		if field.Kind() == reflect.Ptr {
-			if field.IsNil() {
-				continue
-			}
-			field = field.Elem()
-		}
+func DELETE(r *Request) (err error) {
+	return Default().DELETE(r)
+}
 
-		// 處理 time.Time 格式
-		if field.Type() == reflect.TypeOf(time.Time{}) {
-			values.Add(tag, field.Interface().(time.Time).Format(time.RFC3339))
-			continue
-		}
+func (c *Client) GET(r *Request) (err error) {
+	return c.Do(http.MethodGet, r)
+}
 
-		// 處理 slice
-		if field.Kind() == reflect.Slice {
-			for j := 0; j < field.Len(); j++ {
-				values.Add(tag, fmt.Sprintf("%v", field.Index(j).Interface()))
-			}
-			continue
-		}
+func (c *Client) POST(r *Request) (err error) {
+	return c.Do(http.MethodPost, r)
+}
 
-		values.Add(tag, fmt.Sprintf("%v", field.Interface()))
-	}
+func (c *Client) PUT(r *Request) (err error) {
+	return c.Do(http.MethodPut, r)
+}
 
-	res = values.Encode()
+func (c *Client) PATCH(r *Request) (err error) {
+	return c.Do(http.MethodPatch, r)
+}
 
-	return
+func (c *Client) DELETE(r *Request) (err error) {
+	return c.Do(http.MethodDelete, r)
 }
 
-func GET(r *Request) (err error) {
-	req, err := http.NewRequest("GET", r.URL, nil)
+// Do 發送 request 並將結果解析到 r.Result。
+// r.Body 有值時使用 r.Body，否則 GET 時 r.Data 會作為 query string，其餘 method 作為 body
+func (c *Client) Do(method string, r *Request) (err error) {
+	req, cancel, err := c.newRequest(method, r)
 	if err != nil {
-		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", err.Error()))
 		return
 	}
+	defer cancel()
 
-	if r.Data != "" {
-		req.URL.RawQuery = r.Data
-	}
+	return c.exec(req, r)
+}
 
-	if r.Header != nil {
-		req.Header = r.Header
+// Stream 發送 request 並直接回傳 response，不會解析 body，用在下載大檔案等情境。
+// 呼叫端必須關閉 resp.Body，非 2xx 的 status 會回傳錯誤
+//
+// example:
+//
+//	resp, err := request.Default().Stream(http.MethodGet, &request.Request{URL: url, CTX: ctx})
+//	if err != nil {
+//		return
+//	}
+//	defer resp.Body.Close()
+//	io.Copy(w, resp.Body)
+func (c *Client) Stream(method string, r *Request) (resp *http.Response, err error) {
+	req, cancel, err := c.newRequest(method, r)
+	if err != nil {
+		return
 	}
 
-	if r.DefaultHeader {
-		req.Header.Add(consts.HeaderSysToken, basic.SysToken)
-		req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
+	j := newJournal(r, req)
+	resp, retries, err := c.send(parentContext(r), req)
+	if err != nil {
+		j.done(nil, retries, "", err)
+		cancel()
+		return
 	}
 
-	if r.CTX.Context != nil {
-		req = req.WithContext(r.CTX.Context)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		status := resp.StatusCode
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		cancel()
+		err = catch.New(
+			syserrno.HTTP,
+			callUpstreamError,
+			fmt.Sprintf("call %s %s error, status: %d, body: %s", req.Method, redactURL(req.URL), status, string(b)),
+		)
+		j.done(resp, retries, "", err)
+		resp = nil
+		return
 	}
 
-	return exec(req, r)
+	j.done(resp, retries, "", nil)
+
+	// timeout 的 context 需要在讀取完 body 後才能取消
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return
 }
 
-func POST(r *Request) (err error) {
-	req, err := http.NewRequest("POST", r.URL, strings.NewReader(r.Data))
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// newRequest 建立 http.Request，回傳的 cancel 用來釋放 timeout 的 context
+func (c *Client) newRequest(method string, r *Request) (req *http.Request, cancel context.CancelFunc, err error) {
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	switch {
+	case r.Body != nil:
+		body, contentType, err = r.Body.Encode()
+		if err != nil {
+			err = catch.Wrap(err, syserrno.HTTP, "encode request body error", fmt.Sprintf("encode request body error: %s", err.Error()))
+			return
+		}
+	case method != http.MethodGet:
+		body = strings.NewReader(r.Data)
+	}
+
+	req, err = http.NewRequest(method, r.URL, body)
 	if err != nil {
-		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", err.Error()))
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", errorText(err)))
 		return
 	}
 
+	if method == http.MethodGet && r.Data != "" {
+		req.URL.RawQuery = r.Data
+	}
+
 	if r.Header != nil {
-		req.Header = r.Header
+		req.Header = r.Header.Clone()
 	}
 
 	if r.DefaultHeader {
-		req.Header.Add(consts.HeaderSysToken, basic.SysToken)
-		req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if c.conf.Signer == nil {
+			req.Header.Add(consts.HeaderSysToken, basic.SysToken)
+		}
+		if r.CTX != nil {
+			req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
+		}
 	}
 
-	if r.CTX.Context != nil {
-		req = req.WithContext(r.CTX.Context)
+	if body != nil && req.Header.Get("Content-Type") == "" && (r.Body != nil || r.DefaultHeader) {
+		req.Header.Set("Content-Type", contentType)
 	}
 
-	return exec(req, r)
-}
-
-func PUT(r *Request) (err error) {
-	req, err := http.NewRequest("PUT", r.URL, strings.NewReader(r.Data))
-	if err != nil {
-		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", err.Error()))
-		return
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = c.timeout(req.URL.Host)
 	}
 
-	if r.Header != nil {
-		req.Header = r.Header
+	if r.DefaultHeader && c.conf.Signer != nil {
+		err = c.conf.Signer.Sign(req)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			err = catch.Wrap(err, syserrno.HTTP, "sign request error", fmt.Sprintf("sign request error: %s", err.Error()))
+			return
+		}
 	}
 
+	ctx, cancel := context.WithTimeout(parentContext(r), timeout)
+	req = req.WithContext(ctx)
+
 	if r.DefaultHeader {
-		req.Header.Add(consts.HeaderSysToken, basic.SysToken)
-		req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		setTimeoutHeader(req)
 	}
 
-	if r.CTX.Context != nil {
-		req = req.WithContext(r.CTX.Context)
-	}
+	return
+}
 
-	return exec(req, r)
+// parentContext 呼叫端的 context，request 的 timeout 由此衍生
+func parentContext(r *Request) context.Context {
+	if r.CTX != nil && r.CTX.Context != nil {
+		return r.CTX.Context
+	}
+	return context.Background()
 }
 
-func PATCH(r *Request) (err error) {
-	req, err := http.NewRequest("PATCH", r.URL, strings.NewReader(r.Data))
+func (c *Client) exec(req *http.Request, r *Request) (err error) {
+	j := newJournal(r, req)
+	resp, retries, err := c.send(parentContext(r), req)
+	defer func() {
+		j.done(resp, retries, "", err)
+	}()
 	if err != nil {
-		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", err.Error()))
 		return
 	}
+	defer resp.Body.Close()
 
-	if r.Header != nil {
-		req.Header = r.Header
+	if r.Result == nil {
+		return
 	}
 
-	if r.DefaultHeader {
-		req.Header.Add(consts.HeaderSysToken, basic.SysToken)
-		req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	}
+	err = json.NewDecoder(j.capture(resp.Body)).Decode(r.Result)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			err = catch.Wrap(
+				err,
+				syserrno.HTTP,
+				callUpstreamError,
+				fmt.Sprintf("call %s %s error, status: %d, decode result error: %s", req.Method, redactURL(req.URL), resp.StatusCode, err.Error()),
+			)
 
-	if r.CTX.Context != nil {
-		req = req.WithContext(r.CTX.Context)
+			return
+		}
 	}
 
-	return exec(req, r)
+	return
 }
 
-func DELETE(r *Request) (err error) {
-	req, err := http.NewRequest("DELETE", r.URL, strings.NewReader(r.Data))
-	if err != nil {
-		err = catch.New(syserrno.HTTP, "new request error", fmt.Sprintf("new request error: %s", err.Error()))
-		return
+// send 發送請求，經過斷路器並依照 RetryPolicy 重試，retries 為重試的次數。
+// parent 為呼叫端的 context，因 parent 取消或逾時而失敗的請求不計入斷路器。
+// 重試次數用完時最後的 status 仍需要重試（如 503）時回傳 syserrno.HTTPRetryExhausted
+func (c *Client) send(parent context.Context, req *http.Request) (resp *http.Response, retries int, err error) {
+	host := req.URL.Host
+	retryable := c.conf.Retry.retryable(req)
+
+	for ; ; retries++ {
+		if !c.breaker.allow(host) {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			metrics.Add("circuit_open."+host, 1)
+			err = catch.New(
+				syserrno.HTTPCircuitOpen,
+				callUpstreamError+": circuit breaker is open",
+				fmt.Sprintf("circuit breaker of %s is open, req: %s %s", host, req.Method, redactURL(req.URL)),
+			)
+			return
+		}
+
+		if retries > 0 {
+			req, err = rewind(req)
+			if err != nil {
+				err = catch.Wrap(err, syserrno.HTTP, "rewind request body error", fmt.Sprintf("rewind request body error: %s", err.Error()))
+				return
+			}
+
+			// 每次重試都需要新的 nonce
+			if c.conf.Signer != nil && req.Header.Get(consts.HeaderXSignature) != "" {
+				err = c.conf.Signer.Sign(req)
+				if err != nil {
+					err = catch.Wrap(err, syserrno.HTTP, "sign request error", fmt.Sprintf("sign request error: %s", err.Error()))
+					return
+				}
+			}
+		}
+
+		// 重試時更新剩餘的時間
+		if retries > 0 && req.Header.Get(consts.HeaderXRequestTimeout) != "" {
+			setTimeoutHeader(req)
+		}
+
+		metrics.Add("calls."+host, 1)
+		resp, err = c.client.Do(req)
+		if err != nil && parent.Err() != nil {
+			// 呼叫端自己取消或逾時，不代表 host 有問題
+			c.breaker.release(host)
+		} else {
+			c.breaker.done(host, err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+
+		if !retryable || retries >= c.conf.Retry.MaxRetries || req.Context().Err() != nil {
+			break
+		}
+		if err == nil && !c.conf.Retry.retryOnStatus(resp.StatusCode) {
+			break
+		}
+
+		wait := c.conf.Retry.backoff(retries, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			resp = nil
+		}
+
+		metrics.Add("retries."+host, 1)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			err = req.Context().Err()
+		case <-timer.C:
+			continue
+		}
+		break
 	}
 
-	if r.Header != nil {
-		req.Header = r.Header
+	if err == nil && retries > 0 && c.conf.Retry.retryOnStatus(resp.StatusCode) {
+		status := resp.StatusCode
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		resp = nil
+		err = fmt.Errorf("status %d after retries", status)
 	}
 
-	if r.DefaultHeader {
-		req.Header.Add(consts.HeaderSysToken, basic.SysToken)
-		req.Header.Add(consts.HeaderXRequestId, r.CTX.TraceCode)
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if err == nil {
+		return
 	}
 
-	if r.CTX.Context != nil {
-		req = req.WithContext(r.CTX.Context)
+	metrics.Add("failures."+host, 1)
+
+	code := syserrno.HTTP
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = syserrno.HTTPTimeout
+	case retries > 0:
+		code = syserrno.HTTPRetryExhausted
 	}
 
-	return exec(req, r)
+	err = catch.Wrap(err, code, callUpstreamError, fmt.Sprintf("err: %s, attempts: %d, req: %s %s", errorText(err), retries+1, req.Method, redactURL(req.URL)))
+
+	return
 }
 
-func exec(req *http.Request, r *Request) (err error) {
-	client := &http.Client{}
+// errorText 回傳不含 URL 的錯誤訊息，*url.Error 的訊息會帶有完整的 URL
+func errorText(err error) string {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Op + ": " + ue.Err.Error()
+	}
+	return err.Error()
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		err = catch.New(syserrno.HTTP, err.Error(), fmt.Sprintf("err: %s, req: %+v", err.Error(), req))
+// setTimeoutHeader 以 X-Request-Timeout 告知被呼叫端剩餘的時間，被呼叫端的 middleware.Timeout 會以此為期限
+func setTimeoutHeader(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
 
-	err = json.NewDecoder(resp.Body).Decode(r.Result)
-	if err != nil {
-		if resp.StatusCode != http.StatusOK {
-			err = catch.New(
-				syserrno.HTTP,
-				fmt.Sprintf("call %s error: %s", r.URL, err.Error()),
-				fmt.Sprintf("call %s error, resp: %v, req: %+v, header: %+v, err: %s ", r.URL, r.Data, resp, r.Header, err.Error()),
-			)
+	ms := max(time.Until(deadline).Milliseconds(), 1)
+	req.Header.Set(consts.HeaderXRequestTimeout, strconv.FormatInt(ms, 10))
+}
 
-			return
-		}
+// rewind 重新建立 request 的 body 以便重試
+func rewind(req *http.Request) (res *http.Request, err error) {
+	res = req.Clone(req.Context())
+	if req.GetBody == nil {
+		return
 	}
 
+	res.Body, err = req.GetBody()
 	return
 }
@@ -0,0 +1,417 @@
+/*
+package requesttest 提供測試使用 http/request 的程式時需要的工具：
+
+  - Recorder: 將真實的呼叫錄製成 golden file，之後以固定的結果重播
+  - Server: 在測試中啟動回傳 response.Response 格式的 stub server
+
+兩者都可以透過 request.ClientConfig.Transport 或 Client() 注入 http/request：
+
+	rec := requesttest.NewRecorder(t, "testdata/create_order.json", requesttest.ModeFromEnv())
+	defer rec.Save()
+
+	c, _ := request.NewClient(request.ClientConfig{Transport: rec})
+	request.SetDefault(c)
+*/
+package requesttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Mode 錄製或重播
+type Mode int
+
+const (
+	// ModeReplay 只從 golden file 重播，golden file 不存在或格式錯誤時測試直接失敗，找不到對應的紀錄時回傳錯誤並標記測試失敗
+	ModeReplay Mode = iota
+	// ModeRecord 呼叫真實的服務並覆寫 golden file
+	ModeRecord
+	// ModeAuto golden file 存在時重播，不存在時錄製
+	ModeAuto
+)
+
+// RecordEnv 設定為 1 時 ModeFromEnv 回傳 ModeRecord
+const RecordEnv = "HTTP_RECORD"
+
+// ModeFromEnv 依照環境變數 HTTP_RECORD 決定模式，方便在 CI 重播、在本機重新錄製
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) == "1" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Interaction 一次錄製的請求及回應
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Matcher 判斷 request 是否對應到錄製的紀錄，req 的 URL 及 body 為已經遮蔽後的內容
+type Matcher func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// MatchMethodAndURL 預設的 Matcher，比對 method 及完整的 URL
+func MatchMethodAndURL(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method && req.URL.String() == recorded.URL
+}
+
+// MatchBody 比對 method、URL 及 body
+func MatchBody(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	return MatchMethodAndURL(req, body, recorded) && string(body) == recorded.Body
+}
+
+// IgnoreQuery 比對 method、path 及 query，但忽略指定的 query 參數（如時間戳記、nonce）
+func IgnoreQuery(keys ...string) Matcher {
+	return func(req *http.Request, body []byte, recorded RecordedRequest) bool {
+		if req.Method != recorded.Method {
+			return false
+		}
+
+		u, err := req.URL.Parse(recorded.URL)
+		if err != nil {
+			return false
+		}
+
+		if req.URL.Scheme+req.URL.Host+req.URL.Path != u.Scheme+u.Host+u.Path {
+			return false
+		}
+
+		q1, q2 := req.URL.Query(), u.Query()
+		for _, k := range keys {
+			q1.Del(k)
+			q2.Del(k)
+		}
+
+		return q1.Encode() == q2.Encode()
+	}
+}
+
+type Option func(*Recorder)
+
+// WithMatcher 設定比對規則，預設為 MatchMethodAndURL
+func WithMatcher(m Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = m
+	}
+}
+
+// WithRedactHeaders 錄製時遮蔽的標頭，預設遮蔽 SysToken, Authorization, Cookie, Set-Cookie
+func WithRedactHeaders(names ...string) Option {
+	return func(r *Recorder) {
+		r.redactHeaders = append(r.redactHeaders, names...)
+	}
+}
+
+// WithRedactJSONFields 錄製時遮蔽 JSON body 中的欄位（任意層級），
+// 同時也會遮蔽 URL 的 query 參數及 application/x-www-form-urlencoded body 中相同名稱的欄位
+func WithRedactJSONFields(fields ...string) Option {
+	return func(r *Recorder) {
+		r.redactFields = append(r.redactFields, fields...)
+	}
+}
+
+// WithTransport 錄製時實際使用的 transport，預設為 http.DefaultTransport
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+const redacted = "[REDACTED]"
+
+// Recorder 錄製及重播的 http.RoundTripper
+type Recorder struct {
+	t             testing.TB
+	path          string
+	mode          Mode
+	matcher       Matcher
+	transport     http.RoundTripper
+	redactHeaders []string
+	redactFields  []string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder 建立 Recorder，path 為 golden file 的路徑
+func NewRecorder(t testing.TB, path string, mode Mode, opts ...Option) (r *Recorder) {
+	t.Helper()
+
+	r = &Recorder{
+		t:             t,
+		path:          path,
+		mode:          mode,
+		matcher:       MatchMethodAndURL,
+		transport:     http.DefaultTransport,
+		redactHeaders: []string{"SysToken", "Authorization", "Cookie", "Set-Cookie"},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+
+	if r.mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("requesttest: read golden file error: %s, run with %s=1 to record it", err.Error(), RecordEnv)
+			return
+		}
+		if err = json.Unmarshal(b, &r.interactions); err != nil {
+			t.Fatalf("requesttest: unmarshal golden file %s error: %s", path, err.Error())
+			return
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+
+	return
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeReplay {
+		// 錄製的內容已經遮蔽，比對前以相同的規則遮蔽
+		matched := req.Clone(req.Context())
+		matched.URL = r.redactURL(req.URL)
+		resp, err = r.replay(matched, r.redactBody(req.Header, body))
+		if resp != nil {
+			resp.Request = req
+		}
+		return
+	}
+
+	return r.record(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (resp *http.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 依照錄製的順序找第一個還沒使用過的紀錄，同樣的請求呼叫多次時會依序回傳
+	for i, in := range r.interactions {
+		if r.used[i] || !r.matcher(req, body, in.Request) {
+			continue
+		}
+		r.used[i] = true
+
+		resp = &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+		// 遮蔽後 body 的長度可能改變
+		resp.Header.Del("Content-Length")
+		return
+	}
+
+	err = fmt.Errorf("requesttest: no recorded interaction for %s %s in %s", req.Method, req.URL.String(), r.path)
+	// 呼叫端可能忽略錯誤，所以同時標記測試失敗
+	r.t.Errorf("%s", err.Error())
+	return
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (resp *http.Response, err error) {
+	resp, err = r.transport.RoundTrip(req)
+	if err != nil {
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.interactions = append(r.interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.redactURL(req.URL).String(),
+			Header: r.redactHeader(req.Header),
+			Body:   string(r.redactBody(req.Header, body)),
+		},
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: r.redactHeader(resp.Header),
+			Body:   string(r.redactBody(resp.Header, respBody)),
+		},
+	})
+
+	return
+}
+
+// Save 錄製模式時將紀錄寫入 golden file，重播模式時不做任何事
+func (r *Recorder) Save() (err error) {
+	if r.mode != ModeRecord {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.path), 0o755)
+	if err != nil {
+		return
+	}
+
+	err = os.WriteFile(r.path, b, 0o644)
+	return
+}
+
+func (r *Recorder) redactHeader(h http.Header) (res http.Header) {
+	res = h.Clone()
+	for _, name := range r.redactHeaders {
+		if res.Get(name) != "" {
+			res.Set(name, redacted)
+		}
+	}
+	return
+}
+
+// redactURL 遮蔽 query 中 redactFields 的參數，沒有需要遮蔽的參數時回傳原本的 URL
+func (r *Recorder) redactURL(u *url.URL) *url.URL {
+	query, changed := r.redactForm(u.RawQuery)
+	if !changed {
+		return u
+	}
+
+	res := *u
+	res.RawQuery = query
+	return &res
+}
+
+// redactForm 遮蔽 urlencoded 內容中 redactFields 的欄位
+func (r *Recorder) redactForm(raw string) (res string, changed bool) {
+	if len(r.redactFields) == 0 || raw == "" {
+		return raw, false
+	}
+
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw, false
+	}
+
+	for k, vs := range values {
+		if !r.sensitive(k) {
+			continue
+		}
+		for i := range vs {
+			vs[i] = redacted
+		}
+		changed = true
+	}
+	if !changed {
+		return raw, false
+	}
+
+	return values.Encode(), true
+}
+
+func (r *Recorder) redactBody(header http.Header, body []byte) []byte {
+	if len(r.redactFields) == 0 || len(body) == 0 {
+		return body
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		res, _ := r.redactForm(string(body))
+		return []byte(res)
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+
+	v = r.redactValue(v)
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+
+	return b
+}
+
+func (r *Recorder) redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if r.sensitive(k) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = r.redactValue(val)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = r.redactValue(val)
+		}
+	}
+	return v
+}
+
+func (r *Recorder) sensitive(key string) bool {
+	for _, f := range r.redactFields {
+		if strings.EqualFold(f, key) {
+			return true
+		}
+	}
+	return false
+}
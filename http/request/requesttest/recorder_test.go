@@ -0,0 +1,117 @@
+package requesttest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeTB 記錄 Fatalf、Errorf 的呼叫，用來測試 Recorder 讓測試失敗的情況
+type fakeTB struct {
+	testing.TB
+	fatal  string
+	errors []string
+}
+
+func (t *fakeTB) Helper() {}
+
+func (t *fakeTB) Fatalf(format string, args ...any) {
+	t.fatal = fmt.Sprintf(format, args...)
+}
+
+func (t *fakeTB) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	srv := NewServer().Handle(http.MethodPost, "/login", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.URL.Query().Get("token") != "query-secret" || !strings.Contains(string(b), "form-secret") {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=cookie-secret")
+		io.WriteString(w, `{"data":{"accessToken":"json-secret","name":"bob"}}`)
+	}).Start()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "login.json")
+	login := func(rec *Recorder) (status int, body string, err error) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/login?id=1&token=query-secret", strings.NewReader("user=bob&password=form-secret"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer header-secret")
+
+		resp, err := rec.RoundTrip(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), nil
+	}
+
+	rec := NewRecorder(t, path, ModeRecord, WithRedactJSONFields("token", "password", "accessToken"))
+	if status, _, err := login(rec); err != nil || status != http.StatusOK {
+		t.Fatalf("record = %d, %v, want 200", status, err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	golden, _ := os.ReadFile(path)
+	for _, secret := range []string{"query-secret", "form-secret", "header-secret", "cookie-secret", "json-secret"} {
+		if strings.Contains(string(golden), secret) {
+			t.Errorf("golden file contains %q:\n%s", secret, golden)
+		}
+	}
+
+	// 重播時以相同的規則遮蔽後比對
+	rec = NewRecorder(t, path, ModeReplay, WithRedactJSONFields("token", "password", "accessToken"))
+	status, body, err := login(rec)
+	if err != nil || status != http.StatusOK || !strings.Contains(body, `"name":"bob"`) {
+		t.Errorf("replay = %d, %q, %v, want the recorded response", status, body, err)
+	}
+
+	// 同一筆紀錄只會重播一次
+	tb := &fakeTB{}
+	rec = NewRecorder(tb, path, ModeReplay, WithRedactJSONFields("token", "password", "accessToken"))
+	login(rec)
+	if _, _, err := login(rec); err == nil || len(tb.errors) != 1 {
+		t.Errorf("second replay error = %v, test errors = %v, want no recorded interaction", err, tb.errors)
+	}
+}
+
+func TestNewRecorder_invalidGoldenFile(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("{"), 0o644)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "missing", path: filepath.Join(dir, "missing.json")},
+		{name: "corrupt", path: corrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &fakeTB{}
+			NewRecorder(tb, tt.path, ModeReplay)
+			if tb.fatal == "" {
+				t.Errorf("NewRecorder(%s) did not fail the test", tt.path)
+			}
+		})
+	}
+
+	// ModeAuto 沒有 golden file 時錄製
+	tb := &fakeTB{}
+	if rec := NewRecorder(tb, filepath.Join(dir, "missing.json"), ModeAuto); rec.mode != ModeRecord || tb.fatal != "" {
+		t.Errorf("ModeAuto without golden file = %v, %q, want ModeRecord", rec.mode, tb.fatal)
+	}
+}
@@ -0,0 +1,137 @@
+package requesttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/win30221/core/http/consts"
+	"github.com/win30221/core/http/request"
+	"github.com/win30221/core/http/response"
+	"github.com/win30221/core/syserrno"
+)
+
+// Server 回傳 response.Response 格式的 stub server
+//
+// example:
+//
+//	srv := requesttest.NewServer().
+//		OK(http.MethodGet, "/member/user", User{Name: "bob"}).
+//		Error(http.MethodPost, "/order/order", http.StatusBadRequest, "200001", "order not found").
+//		Start()
+//	defer srv.Close()
+//
+//	// 所有經過 Default() 的呼叫都會轉到 stub server，不需要修改 URL
+//	request.SetDefault(srv.Client())
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	routes map[string]http.HandlerFunc
+	calls  map[string]int
+}
+
+func NewServer() *Server {
+	return &Server{
+		routes: map[string]http.HandlerFunc{},
+		calls:  map[string]int{},
+	}
+}
+
+// Handle 註冊自訂的 handler
+func (s *Server) Handle(method, path string, h http.HandlerFunc) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[method+" "+path] = h
+	return s
+}
+
+// OK 回傳 status.code 為 syserrno.OK 的 response，data 為 nil 時與 response.OK 相同回傳 "Success"
+func (s *Server) OK(method, path string, data any) *Server {
+	if data == nil {
+		data = "Success"
+	}
+
+	return s.Handle(method, path, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, data, syserrno.OK, "Success")
+	})
+}
+
+// Error 回傳指定錯誤代碼及訊息的 response
+func (s *Server) Error(method, path string, httpStatus int, code, message string) *Server {
+	return s.Handle(method, path, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, httpStatus, nil, code, message)
+	})
+}
+
+// Start 啟動 server
+func (s *Server) Start() *Server {
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Calls 回傳 method path 被呼叫的次數
+func (s *Server) Calls(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method+" "+path]
+}
+
+// Client 回傳將所有請求轉到 stub server 的 request.Client
+func (s *Server) Client() *request.Client {
+	target, _ := url.Parse(s.URL)
+
+	c, _ := request.NewClient(request.ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	})
+
+	return c
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + r.URL.Path
+
+	s.mu.Lock()
+	s.calls[key]++
+	h, ok := s.routes[key]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, r, http.StatusNotFound, nil, syserrno.Undefined, "requesttest: no stub for "+key)
+		return
+	}
+
+	h(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, httpStatus int, data any, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+
+	json.NewEncoder(w).Encode(response.Response{
+		Data: data,
+		Status: response.Status{
+			Code:      code,
+			Message:   message,
+			TraceCode: r.Header.Get(consts.HeaderXRequestId),
+			DateTime:  time.Now().Format(time.RFC3339),
+		},
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,47 @@
+package requesttest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/request"
+)
+
+func TestServer(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	srv := NewServer().
+		OK(http.MethodGet, "/member/user", user{Name: "bob"}).
+		Error(http.MethodPost, "/order/order", http.StatusBadRequest, "200001", "order not found").
+		Start()
+	defer srv.Close()
+
+	// Client 會將請求轉到 stub server，不需要修改 URL
+	c := srv.Client()
+
+	u, err := request.CallWith[user](c, http.MethodGet, &request.Request{URL: "http://member:8080/member/user", CTX: ctx.NewEmpty()})
+	if err != nil || u.Name != "bob" {
+		t.Errorf("GET /member/user = %+v, %v, want bob", u, err)
+	}
+
+	_, err = request.CallWith[user](c, http.MethodPost, &request.Request{URL: "http://order:8080/order/order", CTX: ctx.NewEmpty()})
+	if e, _ := catch.CheckCustomError(err); e.Code != "200001" {
+		t.Errorf("POST /order/order error = %v, want code 200001", err)
+	}
+
+	_, err = request.CallWith[user](c, http.MethodGet, &request.Request{URL: "http://order:8080/unknown", CTX: ctx.NewEmpty()})
+	if err == nil {
+		t.Error("GET /unknown error = nil, want no stub error")
+	}
+
+	if got := srv.Calls(http.MethodGet, "/member/user"); got != 1 {
+		t.Errorf("Calls(GET /member/user) = %d, want 1", got)
+	}
+	if got := srv.Calls(http.MethodPost, "/order/order"); got != 1 {
+		t.Errorf("Calls(POST /order/order) = %d, want 1", got)
+	}
+}
@@ -0,0 +1,115 @@
+package request
+
+import (
+	"expvar"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/win30221/core/http/consts"
+)
+
+// metrics 對外呼叫的統計，透過 expvar 在 /debug/vars 的 `http_request` 底下輸出，
+// key 格式為 `<name>.<host>`，例如 `retries.order:8080`、`breaker_open.order:8080`
+var metrics = expvar.NewMap("http_request")
+
+// RetryPolicy 重試設定，MaxRetries 為 0 時不重試。
+// 只有 idempotent 的 method（GET, HEAD, OPTIONS, PUT, DELETE）或帶有 Idempotency-Key 標頭的請求才會重試
+type RetryPolicy struct {
+	MaxRetries int
+	// BaseDelay 第一次重試的等待時間，之後每次加倍並加上 jitter
+	BaseDelay time.Duration
+	// MaxDelay 單次等待時間的上限，也是 Retry-After 的上限
+	MaxDelay time.Duration
+	// RetryOn 需要重試的 http status，空值時使用 429, 502, 503, 504
+	RetryOn []int
+}
+
+func (p RetryPolicy) withDefault() RetryPolicy {
+	if p.BaseDelay == 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	if len(p.RetryOn) == 0 {
+		p.RetryOn = []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+	return p
+}
+
+// retryable 檢查 request 是否可以重試
+func (p RetryPolicy) retryable(req *http.Request) bool {
+	if p.MaxRetries <= 0 {
+		return false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get(consts.HeaderIdempotencyKey) != ""
+}
+
+func (p RetryPolicy) retryOnStatus(status int) bool {
+	for _, s := range p.RetryOn {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 計算第 attempt 次重試前的等待時間（exponential backoff + full jitter），
+// 有 Retry-After 時以 Retry-After 為準
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get(consts.HeaderRetryAfter)); ok {
+			return min(d, p.MaxDelay)
+		}
+	}
+
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return rand.N(d) + 1
+}
+
+// parseRetryAfter 支援秒數及 http date 兩種格式
+func parseRetryAfter(v string) (d time.Duration, ok bool) {
+	if v == "" {
+		return
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		if s < 0 {
+			return
+		}
+		return time.Duration(s) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return
+	}
+
+	d = time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
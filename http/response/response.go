@@ -1,14 +1,19 @@
 package response
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/win30221/core/basic"
 	"github.com/win30221/core/http/catch"
+	"github.com/win30221/core/http/consts"
 	"github.com/win30221/core/http/ctx"
+	"github.com/win30221/core/http/i18n"
+	"github.com/win30221/core/http/validate"
 	"github.com/win30221/core/syserrno"
 )
 
@@ -27,6 +32,9 @@ type Response struct {
 
 // Error 用在回傳值需要 data 的時候
 func ErrorD(c *ctx.Context, httpStatusCode int, data any, err error) {
+	httpStatusCode, err = bodyTooLarge(c, httpStatusCode, err)
+	httpStatusCode, err = deadlineExceeded(c, httpStatusCode, err)
+
 	var d any
 
 	if data != nil {
@@ -35,66 +43,69 @@ func ErrorD(c *ctx.Context, httpStatusCode int, data any, err error) {
 
 	customError, ok := catch.CheckCustomError(err)
 	if !ok {
-		c.GinContext.JSON(httpStatusCode, Response{
+		render(c, httpStatusCode, Response{
 			Data: d,
 			Status: Status{
 				Code:      syserrno.Undefined,
-				Message:   err.Error(),
+				Message:   i18n.Translate(c.Lang, syserrno.Undefined, err.Error(), nil),
 				TraceCode: c.TraceCode,
 				DateTime:  time.Now().In(basic.TimeZone).Format(time.RFC3339),
 			},
 		})
 
-		c.GinContext.Error(errors.New(err.Error()))
+		logError(c, errors.New(err.Error()))
 
 		return
 	}
 
 	code, outputMsg, logMsg, stack := customError.Info()
 
-	c.GinContext.JSON(httpStatusCode, Response{
+	render(c, httpStatusCode, Response{
 		Data: d,
 		Status: Status{
 			Code:      code,
 			TraceCode: c.TraceCode,
-			Message:   outputMsg,
+			Message:   i18n.Translate(c.Lang, code, outputMsg, customError.Params()),
 			DateTime:  time.Now().In(basic.TimeZone).Format(time.RFC3339),
 		},
 	})
 
-	c.GinContext.Error(fmt.Errorf("%s, stack:%s", logMsg, stack))
+	logError(c, fmt.Errorf("%s, stack:%s", logMsg, stack))
 }
 
 // Error 用在回傳值沒有需要 data 的時候
 func Error(c *ctx.Context, httpStatusCode int, err error) {
+	httpStatusCode, err = bodyTooLarge(c, httpStatusCode, err)
+	httpStatusCode, err = deadlineExceeded(c, httpStatusCode, err)
+
 	customError, ok := catch.CheckCustomError(err)
 	if !ok {
-		c.GinContext.JSON(httpStatusCode, Response{
+		render(c, httpStatusCode, Response{
 			Status: Status{
 				Code:      syserrno.Undefined,
-				Message:   err.Error(),
+				Message:   i18n.Translate(c.Lang, syserrno.Undefined, err.Error(), nil),
 				TraceCode: c.TraceCode,
 				DateTime:  time.Now().In(basic.TimeZone).Format(time.RFC3339),
 			},
 		})
 
-		c.GinContext.Error(errors.New(err.Error()))
+		logError(c, errors.New(err.Error()))
 
 		return
 	}
 
 	code, outputMsg, logMsg, stack := customError.Info()
 
-	c.GinContext.JSON(httpStatusCode, Response{
+	render(c, httpStatusCode, Response{
 		Status: Status{
 			Code:      code,
 			TraceCode: c.TraceCode,
-			Message:   outputMsg,
+			Message:   i18n.Translate(c.Lang, code, outputMsg, customError.Params()),
 			DateTime:  time.Now().In(basic.TimeZone).Format(time.RFC3339),
 		},
 	})
 
-	c.GinContext.Error(fmt.Errorf("%s, stack:%s", logMsg, stack))
+	logError(c, fmt.Errorf("%s, stack:%s", logMsg, stack))
 }
 
 func OK(c *ctx.Context, data any) {
@@ -110,24 +121,92 @@ func OK(c *ctx.Context, data any) {
 
 	if data != nil {
 		res.Data = data
-		c.GinContext.Set("result", data)
+		c.Set("result", data)
+	}
+
+	render(c, http.StatusOK, res)
+}
+
+// render 沒有 GinContext（如 rmq、cron-job）時不回應
+func render(c *ctx.Context, httpStatusCode int, res any) {
+	if c.GinContext == nil {
+		return
 	}
+	c.GinContext.JSON(httpStatusCode, res)
+}
 
-	c.GinContext.JSON(http.StatusOK, res)
+// logError 將錯誤交給 access log 記錄，沒有 GinContext 時由呼叫端自行處理
+func logError(c *ctx.Context, err error) {
+	if c.GinContext == nil {
+		return
+	}
+	c.GinContext.Error(err)
 }
 
+// BindParameterError 翻譯訊息中可以使用 `{{error}}` 帶入原始錯誤，
+// 若錯誤為欄位驗證錯誤（binding tag），data 會是 []validate.FieldError，
+// 欄位名稱要使用 json/form tag 時需要先呼叫 validate.RegisterGinTagName
 func BindParameterError(c *ctx.Context, err error) {
-	Error(c, http.StatusBadRequest, catch.New(
-		syserrno.ValidParameter,
-		fmt.Sprintf("bind parameter error: %v", err),
-		err.Error(),
-	))
+	parameterError(c, "bind parameter error", err)
 }
 
+// ValidParameterError 翻譯訊息中可以使用 `{{error}}` 帶入原始錯誤，
+// 若錯誤為欄位驗證錯誤，data 會是 []validate.FieldError，
+// 欄位名稱要使用 json/form tag 時需要先呼叫 validate.RegisterTagName
 func ValidParameterError(c *ctx.Context, err error) {
-	Error(c, http.StatusBadRequest, catch.New(
+	parameterError(c, "validate parameter error", err)
+}
+
+func parameterError(c *ctx.Context, prefix string, err error) {
+	fields, ok := validate.Fields(c.Lang, err)
+	if !ok {
+		Error(c, http.StatusBadRequest, catch.WithParams(catch.NewWitStack(
+			syserrno.ValidParameter,
+			fmt.Sprintf("%s: %v", prefix, err),
+			err.Error(),
+			3,
+		), map[string]any{"error": err.Error()}))
+		return
+	}
+
+	messages := make([]string, 0, len(fields))
+	for _, f := range fields {
+		messages = append(messages, f.Message)
+	}
+	msg := strings.Join(messages, "; ")
+
+	ErrorD(c, http.StatusBadRequest, fields, catch.WithParams(catch.NewWitStack(
 		syserrno.ValidParameter,
-		fmt.Sprintf("validate parameter error: %v", err),
+		fmt.Sprintf("%s: %s", prefix, msg),
 		err.Error(),
-	))
+		3,
+	), map[string]any{"error": msg}))
+}
+
+// deadlineExceeded middleware.Timeout 設定的期限已過時，不論 handler 回傳什麼錯誤都改為回傳 504 及 syserrno.Timeout
+func deadlineExceeded(c *ctx.Context, httpStatusCode int, err error) (int, error) {
+	if !errors.Is(c.Err(), context.DeadlineExceeded) || catch.CheckSpecificCode(err, syserrno.Timeout) {
+		return httpStatusCode, err
+	}
+
+	return http.StatusGatewayTimeout, catch.Wrap(
+		err,
+		syserrno.Timeout,
+		"request timeout",
+		fmt.Sprintf("request deadline exceeded, err: %s", err.Error()),
+	)
+}
+
+// bodyTooLarge 請求 body 超過 middleware.BodyLimit 的限制時，handler 讀取 body 的錯誤一律改為回傳 413 及 syserrno.RequestTooLarge
+func bodyTooLarge(c *ctx.Context, httpStatusCode int, err error) (int, error) {
+	if c.GinContext == nil || !c.GinContext.GetBool(consts.KeyBodyTooLarge) || catch.CheckSpecificCode(err, syserrno.RequestTooLarge) {
+		return httpStatusCode, err
+	}
+
+	return http.StatusRequestEntityTooLarge, catch.Wrap(
+		err,
+		syserrno.RequestTooLarge,
+		"request body too large",
+		fmt.Sprintf("request body too large, err: %s", err.Error()),
+	)
 }
@@ -0,0 +1,217 @@
+package sign
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/win30221/core/config"
+)
+
+// ConsulPath 預設存放各服務金鑰的 consul 路徑
+const ConsulPath = "/system/sign_keys"
+
+// Keys 預設的 KeyRing，由 Init 從 consul 載入
+var Keys = NewKeyRing()
+
+// Key 單一金鑰，NotBefore/NotAfter 為零值時表示沒有限制
+type Key struct {
+	ID        string
+	Secret    string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+func (k Key) active(now time.Time) bool {
+	return (k.NotBefore.IsZero() || !now.Before(k.NotBefore)) &&
+		(k.NotAfter.IsZero() || now.Before(k.NotAfter))
+}
+
+// KeyRing 各服務的金鑰，服務名稱及金鑰 id 不分大小寫
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[string][]Key
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: map[string][]Key{}}
+}
+
+// Set 取代 service 的所有金鑰
+func (r *KeyRing) Set(service string, keys ...Key) {
+	for i := range keys {
+		keys[i].ID = strings.ToLower(keys[i].ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys[strings.ToLower(service)] = keys
+}
+
+// SigningKey 取得 service 目前用來簽署的金鑰：有效的金鑰中 NotBefore 最晚的一把。
+// 輪替時先加入 NotBefore 為未來時間的新金鑰，等所有服務都載入後才會開始使用，
+// 舊金鑰在 NotAfter 之前仍可通過驗證
+func (r *KeyRing) SigningKey(service string, now time.Time) (res Key, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys[strings.ToLower(service)] {
+		if !k.active(now) || k.Secret == "" {
+			continue
+		}
+		if !ok || k.NotBefore.After(res.NotBefore) {
+			res, ok = k, true
+		}
+	}
+
+	return
+}
+
+// VerifyingKey 取得 service 指定 id 且目前有效的金鑰
+func (r *KeyRing) VerifyingKey(service, id string, now time.Time) (res Key, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id = strings.ToLower(id)
+	for _, k := range r.keys[strings.ToLower(service)] {
+		if k.ID == id && k.Secret != "" && k.active(now) {
+			return k, true
+		}
+	}
+
+	return
+}
+
+// LoadConsul 從 consul 載入所有服務的金鑰並取代目前的內容
+//
+// 假設 consul 路徑 "/system/sign_keys" 內有下列資料
+// `
+//
+//	[order.k202401]
+//	secret = "..."
+//	not_after = "2024-07-01T00:00:00+08:00"
+//	[order.k202407]
+//	secret = "..."
+//	not_before = "2024-06-25T00:00:00+08:00"
+//	[member.k1]
+//	secret = "..."
+//
+// `
+//
+// 時間格式為 RFC3339，無法解析時該金鑰不會被載入
+func (r *KeyRing) LoadConsul(path string, existOnErr bool) (err error) {
+	m, err := config.GetValues(path, existOnErr)
+	if err != nil {
+		return
+	}
+
+	keys := keysFrom(m)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = keys
+
+	return
+}
+
+// keysFrom 將 consul 的設定轉為各服務的金鑰，not_before、not_after 無法解析的金鑰會被捨棄，
+// 避免設定錯誤時金鑰變成沒有期限
+func keysFrom(m config.Values) (keys map[string][]Key) {
+	// k example: order.k202401.secret
+	byID := map[string]map[string]*Key{}
+	invalid := map[string]bool{}
+	for k := range m {
+		v := m.String(k)
+		rest, field, found := cutLast(k)
+		if !found {
+			continue
+		}
+		service, id, found := strings.Cut(rest, ".")
+		if !found {
+			continue
+		}
+
+		if byID[service] == nil {
+			byID[service] = map[string]*Key{}
+		}
+		key := byID[service][id]
+		if key == nil {
+			key = &Key{ID: id}
+			byID[service][id] = key
+		}
+
+		var err error
+		switch field {
+		case "secret":
+			key.Secret = v
+		case "not_before":
+			key.NotBefore, err = time.Parse(time.RFC3339, v)
+		case "not_after":
+			key.NotAfter, err = time.Parse(time.RFC3339, v)
+		}
+		if err != nil {
+			log.Printf("Error on parse sign key `%s` from consul, the key is ignored, Err: %v", k, err.Error())
+			invalid[rest] = true
+		}
+	}
+
+	keys = map[string][]Key{}
+	for service, ids := range byID {
+		for id, k := range ids {
+			if invalid[service+"."+id] {
+				continue
+			}
+			keys[service] = append(keys[service], *k)
+		}
+		sort.Slice(keys[service], func(i, j int) bool {
+			return keys[service][i].ID < keys[service][j].ID
+		})
+	}
+
+	return
+}
+
+// Watch 每 interval 重新從 consul 載入金鑰，載入失敗時保留原本的金鑰，回傳的 stop 用來停止
+func (r *KeyRing) Watch(path string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.LoadConsul(path, false)
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// Init 從 ConsulPath 載入 Keys，refresh 大於 0 時定期重新載入，讓金鑰輪替不需要重新部署
+func Init(refresh time.Duration) {
+	Keys.LoadConsul(ConsulPath, true)
+
+	if refresh > 0 {
+		Keys.Watch(ConsulPath, refresh)
+	}
+}
+
+func cutLast(s string) (before, after string, found bool) {
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+1:], true
+}
@@ -0,0 +1,92 @@
+package sign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/win30221/core/config"
+)
+
+func Test_KeyRing_Rotation(t *testing.T) {
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	keys := NewKeyRing()
+	keys.Set("Order",
+		Key{ID: "K202401", Secret: "old", NotAfter: base.Add(30 * 24 * time.Hour)},
+		Key{ID: "k202407", Secret: "new", NotBefore: base.Add(24 * time.Hour)},
+		Key{ID: "k-empty"},
+	)
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		signing     string
+		verifyOld   bool
+		verifyNew   bool
+		verifyEmpty bool
+	}{
+		{
+			name:      "before new key",
+			now:       base,
+			signing:   "k202401",
+			verifyOld: true,
+		},
+		{
+			name:      "overlap",
+			now:       base.Add(2 * 24 * time.Hour),
+			signing:   "k202407",
+			verifyOld: true,
+			verifyNew: true,
+		},
+		{
+			name:      "old key expired",
+			now:       base.Add(31 * 24 * time.Hour),
+			signing:   "k202407",
+			verifyNew: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, ok := keys.SigningKey("order", tt.now)
+			if !ok || k.ID != tt.signing {
+				t.Errorf("signing key = %s (%v), want %s", k.ID, ok, tt.signing)
+			}
+			if _, ok := keys.VerifyingKey("ORDER", "k202401", tt.now); ok != tt.verifyOld {
+				t.Errorf("verify old key = %v, want %v", ok, tt.verifyOld)
+			}
+			if _, ok := keys.VerifyingKey("order", "K202407", tt.now); ok != tt.verifyNew {
+				t.Errorf("verify new key = %v, want %v", ok, tt.verifyNew)
+			}
+			if _, ok := keys.VerifyingKey("order", "k-empty", tt.now); ok != tt.verifyEmpty {
+				t.Errorf("verify key without secret = %v, want %v", ok, tt.verifyEmpty)
+			}
+		})
+	}
+
+	if _, ok := keys.SigningKey("member", base); ok {
+		t.Errorf("unknown service should not have signing key")
+	}
+}
+
+func Test_keysFrom(t *testing.T) {
+	keys := NewKeyRing()
+	keys.keys = keysFrom(config.Values{
+		"order.k1.secret":     "old",
+		"order.k1.not_after":  "2024-07-01",
+		"order.k2.secret":     "new",
+		"order.k2.not_before": "2024-06-25T00:00:00+08:00",
+		"member.k1.secret":    "member",
+	})
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, ok := keys.VerifyingKey("order", "k1", now); ok {
+		t.Error("key with malformed not_after should be dropped")
+	}
+	if k, ok := keys.SigningKey("order", now); !ok || k.ID != "k2" {
+		t.Errorf("signing key = %s (%v), want k2", k.ID, ok)
+	}
+	if _, ok := keys.VerifyingKey("member", "k1", now); !ok {
+		t.Error("member key should be loaded")
+	}
+}
@@ -0,0 +1,66 @@
+package sign
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NonceStore 記錄使用過的 nonce，Claim 在 key 第一次出現時回傳 true
+type NonceStore interface {
+	Claim(ctx context.Context, key string, ttl time.Duration) (ok bool, err error)
+}
+
+// MemoryNonceStore 單一 instance 使用的 NonceStore，多個 instance 時請使用 RedisNonceStore
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{seen: map[string]time.Time{}}
+}
+
+func (s *MemoryNonceStore) Claim(ctx context.Context, key string, ttl time.Duration) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// 每 ttl 清除一次過期的 nonce
+	if now.Sub(s.lastSweep) > ttl {
+		for k, expire := range s.seen {
+			if now.After(expire) {
+				delete(s.seen, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expire, exist := s.seen[key]; exist && now.Before(expire) {
+		return
+	}
+
+	s.seen[key] = now.Add(ttl)
+	ok = true
+
+	return
+}
+
+// RedisNonceStore 以 SETNX 記錄 nonce，多個 instance 共用
+type RedisNonceStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisNonceStore rdb 可以使用 storage.GetRedis 取得
+func NewRedisNonceStore(rdb *redis.Client) *RedisNonceStore {
+	return &RedisNonceStore{rdb: rdb, prefix: "sign:nonce:"}
+}
+
+func (s *RedisNonceStore) Claim(ctx context.Context, key string, ttl time.Duration) (ok bool, err error) {
+	return s.rdb.SetNX(ctx, s.prefix+key, 1, ttl).Result()
+}
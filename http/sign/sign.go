@@ -0,0 +1,272 @@
+/*
+package sign 提供內部服務間以 HMAC-SHA256 簽章驗證身分的機制，用來取代共用的 SysToken。
+
+簽章的內容包含 method、path、query、body 的 sha256、時間戳記、nonce、呼叫端服務名稱及金鑰 id，
+每個服務有自己的金鑰（由 Consul 載入），同一個服務可以同時有多把有效期間重疊的金鑰以便輪替。
+
+呼叫端：
+
+	sign.Init(time.Minute)
+	c, _ := request.NewClient(request.ClientConfig{Signer: sign.NewSigner(basic.ServerName, sign.Keys)})
+
+被呼叫端（移轉期間同時接受 SysToken，參考 delivery.RouterConfig）：
+
+	sign.Init(time.Minute)
+	publicGroup, privateGroup := delivery.SetBasicRouter(e, delivery.RouterConfig{
+		Verifier: sign.NewVerifier(sign.Keys, sign.NewRedisNonceStore(rdb)),
+	})
+*/
+package sign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/win30221/core/http/consts"
+)
+
+var (
+	ErrMissingHeader = errors.New("missing signature header")
+	ErrExpired       = errors.New("timestamp out of window")
+	ErrUnknownKey    = errors.New("unknown or inactive key")
+	ErrBodyTooLarge  = errors.New("body too large")
+	ErrBodyHash      = errors.New("body hash mismatch")
+	ErrSignature     = errors.New("signature mismatch")
+	ErrReplay        = errors.New("nonce already used")
+	ErrNoSigningKey  = errors.New("no active signing key")
+)
+
+// Signer 呼叫端使用，以 Service 的金鑰簽署 request
+type Signer struct {
+	Service string
+	Keys    *KeyRing
+}
+
+func NewSigner(service string, keys *KeyRing) *Signer {
+	return &Signer{Service: service, Keys: keys}
+}
+
+// Sign 簽署 request，會覆寫已存在的簽章標頭，重試時需要重新簽署以產生新的 nonce。
+// 無法重複讀取的 body（沒有 GetBody）會被讀進記憶體
+func (s *Signer) Sign(req *http.Request) (err error) {
+	now := time.Now()
+	key, ok := s.Keys.SigningKey(s.Service, now)
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrNoSigningKey, s.Service)
+		return
+	}
+
+	bodyHash, err := hashRequestBody(req)
+	if err != nil {
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req.Header.Set(consts.HeaderXService, s.Service)
+	req.Header.Set(consts.HeaderXKeyId, key.ID)
+	req.Header.Set(consts.HeaderXTimestamp, timestamp)
+	req.Header.Set(consts.HeaderXNonce, nonce)
+	req.Header.Set(consts.HeaderXContentSha256, bodyHash)
+	req.Header.Set(consts.HeaderXSignature, signature(key.Secret, canonical(req, bodyHash, timestamp, nonce, s.Service, key.ID)))
+
+	return
+}
+
+// Verifier 被呼叫端使用，驗證 request 的簽章
+type Verifier struct {
+	Keys   *KeyRing
+	Nonces NonceStore
+	// Window 時間戳記與本機時間允許的誤差，nonce 會保留 2 倍 Window 的時間，預設 5 分鐘
+	Window time.Duration
+	// MaxBodySize 驗證時讀取 body 的上限，預設 32MB
+	MaxBodySize int64
+}
+
+func NewVerifier(keys *KeyRing, nonces NonceStore) *Verifier {
+	return &Verifier{
+		Keys:        keys,
+		Nonces:      nonces,
+		Window:      5 * time.Minute,
+		MaxBodySize: 32 << 20,
+	}
+}
+
+// Verify 驗證 request 的簽章，成功時回傳呼叫端的服務名稱。
+// body 會被讀出後重新放回 req.Body，handler 可以照常讀取
+func (v *Verifier) Verify(req *http.Request) (service string, err error) {
+	h := req.Header
+	caller := h.Get(consts.HeaderXService)
+	keyID := h.Get(consts.HeaderXKeyId)
+	timestamp := h.Get(consts.HeaderXTimestamp)
+	nonce := h.Get(consts.HeaderXNonce)
+	sig := h.Get(consts.HeaderXSignature)
+	if caller == "" || keyID == "" || timestamp == "" || nonce == "" || sig == "" {
+		err = ErrMissingHeader
+		return
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", ErrExpired, timestamp)
+		return
+	}
+
+	now := time.Now()
+	if d := now.Sub(time.Unix(ts, 0)); d > v.Window || d < -v.Window {
+		err = fmt.Errorf("%w: %s", ErrExpired, d)
+		return
+	}
+
+	key, ok := v.Keys.VerifyingKey(caller, keyID, now)
+	if !ok {
+		err = fmt.Errorf("%w: %s/%s", ErrUnknownKey, caller, keyID)
+		return
+	}
+
+	body, err := readBody(req, v.MaxBodySize)
+	if err != nil {
+		return
+	}
+
+	bodyHash := hashBytes(body)
+	if claimed := h.Get(consts.HeaderXContentSha256); claimed != "" && claimed != bodyHash {
+		err = ErrBodyHash
+		return
+	}
+
+	expected := signature(key.Secret, canonical(req, bodyHash, timestamp, nonce, caller, keyID))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		err = ErrSignature
+		return
+	}
+
+	// 驗證簽章後才記錄 nonce，避免偽造的 request 佔用 nonce
+	if v.Nonces != nil {
+		ok, err = v.Nonces.Claim(req.Context(), caller+":"+nonce, 2*v.Window)
+		if err != nil {
+			err = fmt.Errorf("claim nonce error: %w", err)
+			return
+		}
+		if !ok {
+			err = ErrReplay
+			return
+		}
+	}
+
+	service = caller
+	return
+}
+
+// canonical 組合要簽署的字串
+func canonical(req *http.Request, bodyHash, timestamp, nonce, service, keyID string) string {
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		bodyHash,
+		timestamp,
+		nonce,
+		service,
+		keyID,
+	}, "\n")
+}
+
+func signature(secret, s string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashRequestBody(req *http.Request) (res string, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		res = hashBytes(nil)
+		return
+	}
+
+	if req.GetBody == nil {
+		var b []byte
+		b, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			err = fmt.Errorf("read body error: %w", err)
+			return
+		}
+
+		req.ContentLength = int64(len(b))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+		req.Body, _ = req.GetBody()
+		res = hashBytes(b)
+		return
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		err = fmt.Errorf("get body error: %w", err)
+		return
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, body); err != nil {
+		err = fmt.Errorf("read body error: %w", err)
+		return
+	}
+	res = hex.EncodeToString(h.Sum(nil))
+
+	return
+}
+
+func readBody(req *http.Request, limit int64) (b []byte, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+
+	b, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+	req.Body.Close()
+	if err != nil {
+		err = fmt.Errorf("read body error: %w", err)
+		return
+	}
+
+	if int64(len(b)) > limit {
+		err = ErrBodyTooLarge
+		return
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(b))
+
+	return
+}
+
+func newNonce() (res string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		err = fmt.Errorf("generate nonce error: %w", err)
+		return
+	}
+	res = hex.EncodeToString(b)
+	return
+}
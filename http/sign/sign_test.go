@@ -0,0 +1,203 @@
+package sign
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/win30221/core/http/consts"
+)
+
+func newKeys() *KeyRing {
+	keys := NewKeyRing()
+	keys.Set("order", Key{ID: "k1", Secret: "secret"})
+	return keys
+}
+
+func newSignedRequest(t *testing.T, keys *KeyRing, method, url, body string) *http.Request {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if err := NewSigner("order", keys).Sign(req); err != nil {
+		t.Fatalf("sign error: %v", err)
+	}
+	return req
+}
+
+// resign 以指定的時間戳記重新簽署，用來模擬時間誤差
+func resign(req *http.Request, secret string, ts time.Time) {
+	h := req.Header
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	h.Set(consts.HeaderXTimestamp, timestamp)
+	h.Set(consts.HeaderXSignature, signature(secret, canonical(req, h.Get(consts.HeaderXContentSha256), timestamp, h.Get(consts.HeaderXNonce), h.Get(consts.HeaderXService), h.Get(consts.HeaderXKeyId))))
+}
+
+func Test_canonical(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "path and query",
+			url:  "http://order/order/v1?b=2&a=1",
+			want: "POST\n/order/v1\na=1&b=2\nhash\n100\nnonce\norder\nk1",
+		},
+		{
+			name: "escaped path",
+			url:  "http://order/order/a%2Fb",
+			want: "POST\n/order/a%2Fb\n\nhash\n100\nnonce\norder\nk1",
+		},
+		{
+			name: "repeated query",
+			url:  "http://order/?a=2&a=1",
+			want: "POST\n/\na=2&a=1\nhash\n100\nnonce\norder\nk1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, tt.url, nil)
+			if got := canonical(req, "hash", "100", "nonce", "order", "k1"); got != tt.want {
+				t.Errorf("canonical = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	keys := newKeys()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request)
+		want   error
+	}{
+		{
+			name:   "valid",
+			modify: func(req *http.Request) {},
+		},
+		{
+			name:   "missing header",
+			modify: func(req *http.Request) { req.Header.Del(consts.HeaderXNonce) },
+			want:   ErrMissingHeader,
+		},
+		{
+			name:   "skew within window",
+			modify: func(req *http.Request) { resign(req, "secret", now.Add(-4*time.Minute)) },
+		},
+		{
+			name:   "too old",
+			modify: func(req *http.Request) { resign(req, "secret", now.Add(-6*time.Minute)) },
+			want:   ErrExpired,
+		},
+		{
+			name:   "too far in the future",
+			modify: func(req *http.Request) { resign(req, "secret", now.Add(6*time.Minute)) },
+			want:   ErrExpired,
+		},
+		{
+			name:   "unknown key",
+			modify: func(req *http.Request) { req.Header.Set(consts.HeaderXKeyId, "k2") },
+			want:   ErrUnknownKey,
+		},
+		{
+			name:   "unknown service",
+			modify: func(req *http.Request) { req.Header.Set(consts.HeaderXService, "member") },
+			want:   ErrUnknownKey,
+		},
+		{
+			name: "tampered body",
+			modify: func(req *http.Request) {
+				req.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+			},
+			want: ErrBodyHash,
+		},
+		{
+			name: "tampered body without hash header",
+			modify: func(req *http.Request) {
+				req.Header.Del(consts.HeaderXContentSha256)
+				req.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+			},
+			want: ErrSignature,
+		},
+		{
+			name:   "tampered path",
+			modify: func(req *http.Request) { req.URL.Path = "/order/v1/refund" },
+			want:   ErrSignature,
+		},
+		{
+			name:   "tampered query",
+			modify: func(req *http.Request) { req.URL.RawQuery = "id=2" },
+			want:   ErrSignature,
+		},
+		{
+			name:   "wrong secret",
+			modify: func(req *http.Request) { resign(req, "other", now) },
+			want:   ErrSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest(t, keys, http.MethodPost, "http://order/order/v1?id=1", `{"amount":1}`)
+			tt.modify(req)
+
+			service, err := NewVerifier(keys, NewMemoryNonceStore()).Verify(req)
+			if tt.want == nil {
+				if err != nil || service != "order" {
+					t.Fatalf("service: %s, err: %v", service, err)
+				}
+				if b, _ := io.ReadAll(req.Body); string(b) != `{"amount":1}` {
+					t.Errorf("body is not restored: %s", b)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Verify_Replay(t *testing.T) {
+	keys := newKeys()
+	v := NewVerifier(keys, NewMemoryNonceStore())
+
+	req := newSignedRequest(t, keys, http.MethodPost, "http://order/order/v1", "{}")
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(strings.NewReader("{}"))
+
+	if _, err := v.Verify(req); err != nil {
+		t.Fatalf("first verify error: %v", err)
+	}
+	if _, err := v.Verify(replay); !errors.Is(err, ErrReplay) {
+		t.Errorf("replay err = %v, want %v", err, ErrReplay)
+	}
+
+	// 驗證失敗的 request 不會佔用 nonce
+	forged := newSignedRequest(t, keys, http.MethodPost, "http://order/order/v1", "{}")
+	forged.Header.Set(consts.HeaderXSignature, "forged")
+	if _, err := v.Verify(forged); !errors.Is(err, ErrSignature) {
+		t.Fatalf("forged err = %v, want %v", err, ErrSignature)
+	}
+	resign(forged, "secret", time.Now())
+	forged.Body = io.NopCloser(strings.NewReader("{}"))
+	if _, err := v.Verify(forged); err != nil {
+		t.Errorf("nonce of forged request is claimed: %v", err)
+	}
+}
+
+func Test_Verify_BodyTooLarge(t *testing.T) {
+	keys := newKeys()
+	v := NewVerifier(keys, NewMemoryNonceStore())
+	v.MaxBodySize = 4
+
+	req := newSignedRequest(t, keys, http.MethodPost, "http://order/order/v1", "12345")
+	if _, err := v.Verify(req); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("err = %v, want %v", err, ErrBodyTooLarge)
+	}
+}
@@ -1,11 +1,117 @@
 package validate
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/win30221/core/http/i18n"
+)
 
 // request 的 struct filed 統一使用
 var Validate = validator.New()
 
+// defaultMessages 各驗證規則預設的訊息，可以在 i18n catalog 中以 `validate_<rule>` 覆寫，
+// 訊息中可以使用 {{field}}, {{rule}}, {{param}}
+var defaultMessages = map[string]string{
+	"required": "{{field}} is required",
+	"min":      "{{field}} must be at least {{param}}",
+	"max":      "{{field}} must be at most {{param}}",
+	"len":      "{{field}} length must be {{param}}",
+	"eq":       "{{field}} must be equal to {{param}}",
+	"ne":       "{{field}} must not be equal to {{param}}",
+	"gt":       "{{field}} must be greater than {{param}}",
+	"gte":      "{{field}} must be greater than or equal to {{param}}",
+	"lt":       "{{field}} must be less than {{param}}",
+	"lte":      "{{field}} must be less than or equal to {{param}}",
+	"oneof":    "{{field}} must be one of [{{param}}]",
+	"email":    "{{field}} must be a valid email",
+	"url":      "{{field}} must be a valid url",
+	"uuid":     "{{field}} must be a valid uuid",
+	"numeric":  "{{field}} must be numeric",
+	"alpha":    "{{field}} must contain only letters",
+	"alphanum": "{{field}} must contain only letters and numbers",
+	"datetime": "{{field}} must match the format {{param}}",
+}
+
+const defaultMessage = "{{field}} failed on the '{{rule}}' rule"
+
+// FieldError 單一欄位的驗證錯誤，回傳給 client 用來標示錯誤的欄位
+type FieldError struct {
+	// Field 欄位路徑，使用 json/form tag 的名稱，如 `items[0].name`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+// RegisterTagName 讓 Validate 的驗證錯誤（Fields 的 Field）使用 json/form tag 的名稱，
+// 會修改共用的 Validate，需要時在 main 中呼叫一次
+func RegisterTagName() {
+	Validate.RegisterTagNameFunc(tagName)
+}
+
+// RegisterGinTagName 讓 gin 的 ShouldBind（binding tag）的驗證錯誤也使用 json/form tag 的名稱，
+// 會修改 gin 全域的 binding.Validator，需要時在 main 中呼叫一次
+func RegisterGinTagName() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(tagName)
+	}
+}
+
+func tagName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// messageKey 驗證規則在 i18n catalog 中的 key，catalog 以 viper 載入時 "." 會被視為巢狀的 key，所以使用 "_"
+func messageKey(rule string) string {
+	return "validate_" + rule
+}
+
 // delivery 在 c.ShouldBind() 之後使用 Validate.Struct() 來驗證傳入參數
 func Struct(s any) error {
 	return Validate.Struct(s)
 }
+
+// Fields 將 validator.ValidationErrors 轉為指定語系的 FieldError，err 不是驗證錯誤時 ok 為 false
+func Fields(lang string, err error) (res []FieldError, ok bool) {
+	var ves validator.ValidationErrors
+	if !errors.As(err, &ves) {
+		return
+	}
+
+	ok = true
+	for _, fe := range ves {
+		// Namespace 的第一段為 struct 名稱，如 `Req.items[0].name`
+		_, field, found := strings.Cut(fe.Namespace(), ".")
+		if !found {
+			field = fe.Field()
+		}
+
+		message, exist := defaultMessages[fe.Tag()]
+		if !exist {
+			message = defaultMessage
+		}
+
+		res = append(res, FieldError{
+			Field: field,
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+			Message: i18n.Translate(lang, messageKey(fe.Tag()), message, map[string]any{
+				"field": field,
+				"rule":  fe.Tag(),
+				"param": fe.Param(),
+			}),
+		})
+	}
+
+	return
+}
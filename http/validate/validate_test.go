@@ -0,0 +1,79 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/win30221/core/http/i18n"
+)
+
+func TestFields(t *testing.T) {
+	RegisterTagName()
+
+	path := filepath.Join(t.TempDir(), "i18n.toml")
+	catalog := `
+[zh-tw]
+validate_required = "{{field}} 為必填"
+`
+	if err := os.WriteFile(path, []byte(catalog), 0o644); err != nil {
+		t.Fatalf("write catalog error: %v", err)
+	}
+	if err := i18n.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error: %v", err)
+	}
+
+	type item struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type req struct {
+		UserID string `json:"user_id" validate:"required"`
+		Age    int    `form:"age" validate:"min=18"`
+		Items  []item `json:"items" validate:"dive"`
+	}
+
+	err := Struct(req{Age: 1, Items: []item{{}}})
+
+	tests := []struct {
+		name string
+		lang string
+		want []FieldError
+	}{
+		{
+			name: "translated",
+			lang: "zh-tw",
+			want: []FieldError{
+				{Field: "user_id", Rule: "required", Message: "user_id 為必填"},
+				{Field: "age", Rule: "min", Param: "18", Message: "age must be at least 18"},
+				{Field: "items[0].name", Rule: "required", Message: "items[0].name 為必填"},
+			},
+		},
+		{
+			name: "default message",
+			lang: "en",
+			want: []FieldError{
+				{Field: "user_id", Rule: "required", Message: "user_id is required"},
+				{Field: "age", Rule: "min", Param: "18", Message: "age must be at least 18"},
+				{Field: "items[0].name", Rule: "required", Message: "items[0].name is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Fields(tt.lang, err)
+			if !ok || len(got) != len(tt.want) {
+				t.Fatalf("Fields() = %+v, %v, want %+v", got, ok, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Fields()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, ok := Fields("en", os.ErrNotExist); ok {
+		t.Error("Fields() with a non validation error ok = true, want false")
+	}
+}
@@ -8,10 +8,11 @@ import (
 	"github.com/win30221/core/http/catch"
 	"github.com/win30221/core/syserrno"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	ErrNoDocuments = catch.New(syserrno.Mongo, "no documents in result", "no documents in result")
+	ErrNoDocuments = catch.Wrap(mongo.ErrNoDocuments, syserrno.Mongo, "no documents in result", "no documents in result")
 )
 
 // ToDoc 會將 struct 轉為 bson 格式
@@ -35,13 +36,13 @@ var (
 func ToDoc(v any) (doc *bson.M, err error) {
 	data, err := bson.Marshal(v)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Mongo, "marshal bson error", fmt.Sprintf("marshal bson error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Mongo, "marshal bson error", fmt.Sprintf("marshal bson error. err: %s", err.Error()), 3)
 		return
 	}
 
 	err = bson.Unmarshal(data, &doc)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Mongo, "unmarshal bson error", fmt.Sprintf("marshal bson error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Mongo, "unmarshal bson error", fmt.Sprintf("marshal bson error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -7,12 +7,11 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/win30221/core/http/consts"
 	"github.com/win30221/core/http/ctx"
-	"github.com/win30221/core/http/middleware"
 )
 
-func buildSQLLog(ctx *gin.Context, query string, args ...any) {
+func buildSQLLog(ctx *ctx.Context, query string, args ...any) {
 	res := query
 	for _, arg := range args {
 		switch v := arg.(type) {
@@ -24,63 +23,58 @@ func buildSQLLog(ctx *gin.Context, query string, args ...any) {
 			res = strings.Replace(res, "?", fmt.Sprintf("%v", arg), 1)
 		}
 	}
-	logs, exists := ctx.Get(middleware.SQLLogs)
-	if !exists {
-		ctx.Set(middleware.SQLLogs, []string{})
-		logs, _ = ctx.Get(middleware.SQLLogs)
-	}
-	ctx.Set(middleware.SQLLogs, append(logs.([]string), res))
+	ctx.Append(consts.KeySQLLogs, res)
 }
 
 func QueryRowContext(ctx *ctx.Context, db *sql.DB, query string, args ...any) (res *sql.Row) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res = db.QueryRowContext(ctx.Context, query, args...)
 	return
 }
 
 func QueryContext(ctx *ctx.Context, db *sql.DB, query string, args ...any) (res *sql.Rows, err error) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res, err = db.QueryContext(ctx.Context, query, args...)
 	return
 }
 
 func ExecContext(ctx *ctx.Context, db *sql.DB, query string, args ...any) (res sql.Result, err error) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res, err = db.ExecContext(ctx.Context, query, args...)
 	return
 }
 
 func BeginTx(ctx *ctx.Context, db *sql.DB) (tx *sql.Tx, err error) {
-	buildSQLLog(ctx.GinContext, "BEGIN;")
+	buildSQLLog(ctx, "BEGIN;")
 	tx, err = db.BeginTx(ctx.Context, nil)
 	return
 }
 
 func Commit(ctx *ctx.Context, tx *sql.Tx) (err error) {
-	buildSQLLog(ctx.GinContext, "COMMIT;")
+	buildSQLLog(ctx, "COMMIT;")
 	err = tx.Commit()
 	return
 }
 
 func Rollback(ctx *ctx.Context, tx *sql.Tx) {
-	buildSQLLog(ctx.GinContext, "ROLLBACK;")
+	buildSQLLog(ctx, "ROLLBACK;")
 	tx.Rollback()
 }
 
 func QueryRowContextTx(ctx *ctx.Context, db *sql.Tx, query string, args ...any) (res *sql.Row) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res = db.QueryRowContext(ctx.Context, query, args...)
 	return
 }
 
 func QueryContextTx(ctx *ctx.Context, db *sql.Tx, query string, args ...any) (res *sql.Rows, err error) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res, err = db.QueryContext(ctx.Context, query, args...)
 	return
 }
 
 func ExecContextTx(ctx *ctx.Context, db *sql.Tx, query string, args ...any) (res sql.Result, err error) {
-	buildSQLLog(ctx.GinContext, query, args...)
+	buildSQLLog(ctx, query, args...)
 	res, err = db.ExecContext(ctx.Context, query, args...)
 	return
 }
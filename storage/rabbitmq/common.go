@@ -3,8 +3,11 @@ package rabbitmq
 // https://medium.com/@dhanushgopinath/automatically-recovering-rabbitmq-connections-in-go-applications-7795a605ca59
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -23,6 +26,23 @@ type Message struct {
 	CorrelationId string
 	Priority      uint8
 	Body          MessageBody
+	// Deadline 有值時會設定訊息的 Expiration，並以 HeaderDeadline 傳給 consumer，參考 DeliveryContext
+	Deadline time.Time
+	// TraceCode 以 X-Request-Id 標頭傳給 consumer，ctx.FromMessage 會沿用
+	TraceCode string
+}
+
+// HeaderDeadline 訊息處理期限（unix 毫秒）的 header
+const HeaderDeadline = "x-deadline"
+
+// DeliveryContext 依照訊息的 HeaderDeadline 建立 context，用在 RPC 的 consumer，
+// 讓呼叫端的期限延續到 consumer 的 MySQL、Mongo、Redis 等操作，沒有期限時回傳可以取消的 context。
+// 需要 traceCode 或 SQL 紀錄時再以 ctx.FromMessage 建立 *ctx.Context
+func DeliveryContext(d amqp.Delivery) (context.Context, context.CancelFunc) {
+	if ms, ok := d.Headers[HeaderDeadline].(int64); ok {
+		return context.WithDeadline(context.Background(), time.UnixMilli(ms))
+	}
+	return context.WithCancel(context.Background())
 }
 
 // Connection is the connection created
@@ -36,6 +56,17 @@ type Connection struct {
 	routingKey   string
 	qos          int
 	err          chan error
+	confirm      *confirmState
+}
+
+// confirmState PublishConfirm 使用的 channel，與 Publish 分開，避免 delivery tag 錯亂
+type confirmState struct {
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	seq      uint64
 }
 
 // NewConnection returns the new connection object
@@ -47,6 +78,7 @@ func NewConnection(cfg amqp.URI, exchange, exchangeType, queue string, qos int)
 		queue:        queue,
 		qos:          qos,
 		err:          make(chan error),
+		confirm:      &confirmState{},
 	}
 	return c
 }
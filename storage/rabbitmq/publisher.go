@@ -1,13 +1,141 @@
 package rabbitmq
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/streadway/amqp"
+	"github.com/win30221/core/http/consts"
 )
 
 func (c *Connection) Publish(m Message) error {
+	c.checkConnection()
+
+	p, err := newPublishing(m)
+	if err != nil {
+		return err
+	}
+
+	if err := c.channel.Publish(c.exchange, m.Queue, false, false, p); err != nil {
+		return fmt.Errorf("error in Publishing: %s", err)
+	}
+	return nil
+}
+
+// PublishConfirm 以 mandatory 送出訊息並等待 broker 確認（publisher confirms），
+// 訊息無法路由到任何 queue、被 broker 拒絕或 timeout 內沒有確認時回傳錯誤。
+// 同一個 Connection 的 PublishConfirm 會依序執行，需要大量送出時使用 Publish
+func (c *Connection) PublishConfirm(m Message, timeout time.Duration) error {
+	c.checkConnection()
+
+	p, err := newPublishing(m)
+	if err != nil {
+		return err
+	}
+
+	cs := c.confirm
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := c.enableConfirm(); err != nil {
+		return err
+	}
+
+	// 上一次 timeout 後才收到的 return 不屬於這次的訊息
+	drainReturns(cs.returns)
+
+	if err := cs.channel.Publish(c.exchange, m.Queue, true, false, p); err != nil {
+		cs.channel = nil
+		return fmt.Errorf("error in Publishing: %s", err)
+	}
+	cs.seq++
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case confirm, ok := <-cs.confirms:
+			if !ok {
+				cs.channel = nil
+				return errors.New("error in Publishing: channel closed before confirm")
+			}
+			if confirm.DeliveryTag < cs.seq {
+				// 之前 timeout 的訊息，broker 會先送 return 再送 ack
+				drainReturns(cs.returns)
+				continue
+			}
+
+			// broker 會在 ack 之前送出 return
+			select {
+			case r, ok := <-cs.returns:
+				if !ok {
+					cs.channel = nil
+					return errors.New("error in Publishing: channel closed before confirm")
+				}
+				return fmt.Errorf("error in Publishing: message returned: %d %s", r.ReplyCode, r.ReplyText)
+			default:
+			}
+
+			if !confirm.Ack {
+				return errors.New("error in Publishing: message nacked by broker")
+			}
+			return nil
+		case <-timer.C:
+			return errors.New("error in Publishing: confirm timeout")
+		}
+	}
+}
+
+// enableConfirm 在第一次使用或重新連線後建立 confirm 模式的 channel
+func (c *Connection) enableConfirm() (err error) {
+	cs := c.confirm
+	if cs.channel != nil && cs.conn == c.conn {
+		return
+	}
+
+	if cs.channel != nil {
+		cs.channel.Close()
+		cs.channel = nil
+	}
+
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("error in Publishing: confirm channel: %s", err)
+	}
+
+	if err = ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("error in Publishing: confirm mode: %s", err)
+	}
+
+	cs.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	cs.returns = ch.NotifyReturn(make(chan amqp.Return, 64))
+	cs.conn = c.conn
+	cs.channel = ch
+	cs.seq = 0
+
+	return
+}
+
+func drainReturns(returns chan amqp.Return) {
+	for {
+		select {
+		case _, ok := <-returns:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// checkConnection 連線中斷時重新連線
+func (c *Connection) checkConnection() {
 	select { //non blocking channel - if there is no error will go to default where we do nothing
 	case err := <-c.err:
 		if err != nil {
@@ -18,16 +146,31 @@ func (c *Connection) Publish(m Message) error {
 		}
 	default:
 	}
+}
 
-	p := amqp.Publishing{
+func newPublishing(m Message) (p amqp.Publishing, err error) {
+	p = amqp.Publishing{
 		Headers:       amqp.Table{"type": m.Body.Type},
 		ContentType:   m.ContentType,
 		CorrelationId: m.CorrelationId,
 		Body:          m.Body.Data,
 		ReplyTo:       m.ReplyTo,
 	}
-	if err := c.channel.Publish(c.exchange, m.Queue, false, false, p); err != nil {
-		return fmt.Errorf("error in Publishing: %s", err)
+
+	if m.TraceCode != "" {
+		p.Headers[consts.HeaderXRequestId] = m.TraceCode
 	}
-	return nil
+
+	if !m.Deadline.IsZero() {
+		remaining := time.Until(m.Deadline)
+		if remaining <= 0 {
+			err = fmt.Errorf("error in Publishing: deadline exceeded")
+			return
+		}
+		// 超過期限的訊息由 rabbitmq 直接丟棄，不會被 consume
+		p.Expiration = strconv.FormatInt(max(remaining.Milliseconds(), 1), 10)
+		p.Headers[HeaderDeadline] = m.Deadline.UnixMilli()
+	}
+
+	return
 }
@@ -24,13 +24,13 @@ func Get(ctx *ctx.Context, rdb *redis.Client, key string, result any) (err error
 		return
 	}
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "get data error", fmt.Sprintf("execute GET command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "get data error", fmt.Sprintf("execute GET command error. err: %s", err.Error()), 3)
 		return
 	}
 
 	err = json.Unmarshal(b, result)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "get data error", fmt.Sprintf("unmarshal data error. err: %s, got: %s", err.Error(), string(b)), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "get data error", fmt.Sprintf("unmarshal data error. err: %s, got: %s", err.Error(), string(b)), 3)
 		return
 	}
 
@@ -40,13 +40,13 @@ func Get(ctx *ctx.Context, rdb *redis.Client, key string, result any) (err error
 func Set(ctx *ctx.Context, rdb *redis.Client, key string, data any) (err error) {
 	b, err := json.Marshal(data)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "set data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "set data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
 		return
 	}
 
 	_, err = rdb.Set(ctx.Context, key, b, 0).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "set data error", fmt.Sprintf("execute SET command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "set data error", fmt.Sprintf("execute SET command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -56,13 +56,13 @@ func Set(ctx *ctx.Context, rdb *redis.Client, key string, data any) (err error)
 func SetEX(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration, data any) (err error) {
 	b, err := json.Marshal(data)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "setex data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "setex data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
 		return
 	}
 
 	_, err = rdb.Set(ctx.Context, key, b, ttl).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "setex data error", fmt.Sprintf("execute SETEX command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "setex data error", fmt.Sprintf("execute SETEX command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -72,13 +72,13 @@ func SetEX(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration, d
 func SetNX(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration, data any) (err error) {
 	b, err := json.Marshal(data)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "setnx data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "setnx data error", fmt.Sprintf("marshal data error. err: %s, data: %+v", err.Error(), data), 3)
 		return
 	}
 
 	ok, err := rdb.SetNX(ctx.Context, key, b, ttl).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "setnx data error", fmt.Sprintf("execute SETNX command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "setnx data error", fmt.Sprintf("execute SETNX command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -93,7 +93,7 @@ func SetNX(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration, d
 func Del(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 	_, err = rdb.Del(ctx.Context, key).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "del error", fmt.Sprintf("execute DEL command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "del error", fmt.Sprintf("execute DEL command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -103,7 +103,7 @@ func Del(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 func Exists(ctx *ctx.Context, rdb *redis.Client, key string) (isExist bool, err error) {
 	res, err := rdb.Exists(ctx.Context, key).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "check exist error", fmt.Sprintf("execcute EXISTS command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "check exist error", fmt.Sprintf("execcute EXISTS command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -119,7 +119,7 @@ func FuzzyDel(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 	for {
 		keys, cursor, err = rdb.Scan(ctx.Context, cursor, "*"+key+"*", 0).Result()
 		if err != nil {
-			err = catch.NewWitStack(syserrno.Redis, "fuzzy del error", fmt.Sprintf("execute SCAN command error. err: %s", err.Error()), 3)
+			err = catch.WrapWitStack(err, syserrno.Redis, "fuzzy del error", fmt.Sprintf("execute SCAN command error. err: %s", err.Error()), 3)
 			return
 		}
 
@@ -136,7 +136,7 @@ func FuzzyDel(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 
 	_, err = rdb.Unlink(ctx.Context, target...).Result()
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "fuzzy del error", fmt.Sprintf("execute UNLINK command error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "fuzzy del error", fmt.Sprintf("execute UNLINK command error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -146,7 +146,7 @@ func FuzzyDel(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 func Lock(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration) (err error) {
 	err = SetNX(ctx, rdb, key, ttl, "")
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "Lock error", fmt.Sprintf("Lock error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "Lock error", fmt.Sprintf("Lock error. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -156,7 +156,7 @@ func Lock(ctx *ctx.Context, rdb *redis.Client, key string, ttl time.Duration) (e
 func Unlock(ctx *ctx.Context, rdb *redis.Client, key string) (err error) {
 	err = Del(ctx, rdb, key)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.Redis, "Unlock error", fmt.Sprintf("Unlock error. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.Redis, "Unlock error", fmt.Sprintf("Unlock error. err: %s", err.Error()), 3)
 		return
 	}
 
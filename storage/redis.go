@@ -51,6 +51,8 @@ func GetRedis(path, dbName string) (rdb *redis.Client) {
 		Password:     password,
 		DB:           db,
 		MaxIdleConns: maxIdle,
+		// 讓 ctx.Context 的期限（middleware.Timeout）也套用在 redis 指令上
+		ContextTimeoutEnabled: true,
 	})
 
 	// rdb = &redigo.Pool{
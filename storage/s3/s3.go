@@ -101,7 +101,7 @@ func (s *Storage) UploadImage(ctx context.Context, dirPath, filename, contentTyp
 		},
 	)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.AWSS3, "s3.Upload failed", fmt.Sprintf("s3.Upload failed. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.AWSS3, "s3.Upload failed", fmt.Sprintf("s3.Upload failed. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -125,7 +125,7 @@ func (s *Storage) DeleteImage(ctx context.Context, dirPath, filename string) (er
 		},
 	)
 	if err != nil {
-		err = catch.NewWitStack(syserrno.AWSS3, "s3.Upload failed", fmt.Sprintf("s3.Upload failed. err: %s", err.Error()), 3)
+		err = catch.WrapWitStack(err, syserrno.AWSS3, "s3.Upload failed", fmt.Sprintf("s3.Upload failed. err: %s", err.Error()), 3)
 		return
 	}
 
@@ -0,0 +1,274 @@
+/*
+package catalog 將 syserrno 中註冊的錯誤代碼與 i18n 的翻譯匯出為 Markdown、JSON 及 OpenAPI components，
+讓文件與程式碼保持一致。
+
+service 的錯誤代碼註冊在各自的 package 中，因此 service 需要建立自己的指令並 import 這些 package：
+
+	package main
+
+	import (
+		"github.com/win30221/core/syserrno/catalog"
+
+		_ "example.com/order/errno"
+	)
+
+	func main() {
+		catalog.Main()
+	}
+*/
+package catalog
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/win30221/core/config"
+	"github.com/win30221/core/http/i18n"
+	"github.com/win30221/core/syserrno"
+)
+
+const (
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+	FormatOpenAPI  = "openapi"
+)
+
+type Entry struct {
+	Code        string `json:"code"`
+	HTTPStatus  int    `json:"httpStatus"`
+	Description string `json:"description"`
+	// Messages lang -> message
+	Messages map[string]string `json:"messages,omitempty"`
+}
+
+type Catalog struct {
+	Languages []string `json:"languages"`
+	Entries   []Entry  `json:"entries"`
+}
+
+// Build 收集所有已註冊的錯誤代碼及目前 i18n catalog 中的翻譯
+func Build() (res Catalog) {
+	res.Languages = i18n.Languages()
+	res.Entries = []Entry{}
+
+	for _, e := range syserrno.Entries() {
+		entry := Entry{
+			Code:        e.Code,
+			HTTPStatus:  e.HTTPStatus,
+			Description: e.Description,
+			Messages:    map[string]string{},
+		}
+
+		for _, lang := range res.Languages {
+			if message, ok := i18n.Message(lang, e.Code); ok {
+				entry.Messages[lang] = message
+			}
+		}
+
+		res.Entries = append(res.Entries, entry)
+	}
+
+	return
+}
+
+// Write 依照 format 輸出 catalog
+func Write(w io.Writer, c Catalog, format string) (err error) {
+	switch format {
+	case FormatMarkdown:
+		err = WriteMarkdown(w, c)
+	case FormatJSON:
+		err = WriteJSON(w, c)
+	case FormatOpenAPI:
+		err = WriteOpenAPI(w, c)
+	default:
+		err = fmt.Errorf("unsupported format `%s`, allow %s, %s, %s", format, FormatMarkdown, FormatJSON, FormatOpenAPI)
+	}
+	return
+}
+
+func WriteMarkdown(w io.Writer, c Catalog) (err error) {
+	var sb strings.Builder
+
+	sb.WriteString("| Code | HTTP Status | Description |")
+	for _, lang := range c.Languages {
+		sb.WriteString(" " + lang + " |")
+	}
+	sb.WriteString("\n|---|---|---|")
+	for range c.Languages {
+		sb.WriteString("---|")
+	}
+	sb.WriteString("\n")
+
+	for _, e := range c.Entries {
+		sb.WriteString(fmt.Sprintf("| `%s` | %d | %s |", e.Code, e.HTTPStatus, escapeMarkdown(e.Description)))
+		for _, lang := range c.Languages {
+			sb.WriteString(" " + escapeMarkdown(e.Messages[lang]) + " |")
+		}
+		sb.WriteString("\n")
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func WriteJSON(w io.Writer, c Catalog) (err error) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(c)
+	return
+}
+
+// WriteOpenAPI 輸出 OpenAPI 3 的 components 片段，包含 ErrorCode 列舉、response.Response 的結構，
+// 以及每個 http status 可能回傳的錯誤代碼範例
+func WriteOpenAPI(w io.Writer, c Catalog) (err error) {
+	codes := []string{}
+	descriptions := []string{}
+	responses := map[string]any{}
+
+	for _, e := range c.Entries {
+		codes = append(codes, e.Code)
+		descriptions = append(descriptions, e.Description)
+
+		if e.Code == syserrno.OK {
+			continue
+		}
+
+		name := "Error" + strconv.Itoa(e.HTTPStatus)
+		if _, ok := responses[name]; !ok {
+			responses[name] = map[string]any{
+				"description": http.StatusText(e.HTTPStatus),
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema":   map[string]any{"$ref": "#/components/schemas/ErrorResponse"},
+						"examples": map[string]any{},
+					},
+				},
+			}
+		}
+
+		message := e.Description
+		for _, lang := range c.Languages {
+			if m, ok := e.Messages[lang]; ok {
+				message = m
+				break
+			}
+		}
+
+		examples := responses[name].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["examples"].(map[string]any)
+		examples[e.Code] = map[string]any{
+			"summary": e.Description,
+			"value": map[string]any{
+				"data": nil,
+				"status": map[string]any{
+					"code":      e.Code,
+					"message":   message,
+					"dateTime":  "2006-01-02T15:04:05+08:00",
+					"traceCode": "",
+				},
+			},
+		}
+	}
+
+	fragment := map[string]any{
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"ErrorCode": map[string]any{
+					"type":                "string",
+					"enum":                codes,
+					"x-enum-descriptions": descriptions,
+				},
+				"Status": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"code":      map[string]any{"$ref": "#/components/schemas/ErrorCode"},
+						"message":   map[string]any{"type": "string"},
+						"dateTime":  map[string]any{"type": "string", "format": "date-time"},
+						"traceCode": map[string]any{"type": "string"},
+					},
+				},
+				"ErrorResponse": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"data":   map[string]any{"nullable": true},
+						"status": map[string]any{"$ref": "#/components/schemas/Status"},
+					},
+				},
+			},
+			"responses": responses,
+		},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(fragment)
+	return
+}
+
+// Main 給 cmd/errcatalog 或 service 自己的指令使用
+//
+//	-f 輸出格式 md, json, openapi
+//	-o 輸出檔案，預設為 stdout
+//	-i i18n 翻譯檔，多個檔案以逗號分隔
+//	-c consul IP
+//	-k consul 的 i18n key，例如 /system/i18n/messages
+func Main() {
+	var format, output, files, consulIP, consulKey string
+	flag.StringVar(&format, "f", FormatMarkdown, "Output format: md, json, openapi")
+	flag.StringVar(&output, "o", "", "Output file, default stdout")
+	flag.StringVar(&files, "i", "", "I18n message files, separated by comma")
+	flag.StringVar(&consulIP, "c", "127.0.0.1", "Consul IP")
+	flag.StringVar(&consulKey, "k", "", "Consul key of i18n messages")
+	flag.Parse()
+
+	if err := run(format, output, files, consulIP, consulKey); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// run 回傳錯誤而不是直接結束，讓 defer 的 Close 可以執行
+func run(format, output, files, consulIP, consulKey string) (err error) {
+	for _, f := range strings.Split(files, ",") {
+		if f == "" {
+			continue
+		}
+
+		if err = i18n.LoadFile(f); err != nil {
+			return
+		}
+	}
+
+	if consulKey != "" {
+		config.Load(consulIP)
+		if err = i18n.LoadConsul(consulKey, false); err != nil {
+			err = fmt.Errorf("load i18n from consul `%s` error: %s", consulKey, err.Error())
+			return
+		}
+	}
+
+	if output == "" {
+		return Write(os.Stdout, Build(), format)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return
+	}
+
+	if err = Write(f, Build(), format); err != nil {
+		f.Close()
+		return
+	}
+
+	return f.Close()
+}
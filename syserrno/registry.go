@@ -0,0 +1,119 @@
+package syserrno
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Entry 錯誤代碼的說明，給 syserrno/catalog 產生文件使用
+type Entry struct {
+	Code string
+	// HTTPStatus 回傳此錯誤代碼時通常使用的 http status
+	HTTPStatus  int
+	Description string
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Entry{}
+)
+
+func init() {
+	register(OK, http.StatusOK, "success")
+	register(Undefined, http.StatusInternalServerError, "undefined error")
+	register(HTTP, http.StatusBadGateway, "call remote http service error")
+	register(HTTPTimeout, http.StatusGatewayTimeout, "call remote http service timeout")
+	register(HTTPRetryExhausted, http.StatusBadGateway, "call remote http service failed after retries")
+	register(HTTPCircuitOpen, http.StatusServiceUnavailable, "remote http service circuit breaker is open")
+	register(ValidParameter, http.StatusBadRequest, "bind or validate parameter error")
+	register(Unauthorized, http.StatusUnauthorized, "unauthorized")
+	register(InvalidSignature, http.StatusUnauthorized, "invalid inter-service request signature")
+	register(InvalidSysToken, http.StatusUnauthorized, "invalid system token")
+	register(InvalidToken, http.StatusUnauthorized, "invalid or expired access token")
+	register(IPNotAllowed, http.StatusForbidden, "client ip is not allowed")
+	register(RMQ, http.StatusInternalServerError, "rabbitmq error")
+	register(TooManyRequests, http.StatusTooManyRequests, "too many requests")
+	register(Timeout, http.StatusGatewayTimeout, "request deadline exceeded")
+	register(Conflict, http.StatusConflict, "conflict")
+	register(RequestTooLarge, http.StatusRequestEntityTooLarge, "request body too large")
+	register(IdempotencyInProgress, http.StatusConflict, "a request with the same idempotency key is in progress")
+	register(IdempotencyKeyReused, http.StatusConflict, "idempotency key was used with a different request")
+	register(Mongo, http.StatusInternalServerError, "mongodb error")
+	register(MySQL, http.StatusInternalServerError, "mysql error")
+	register(Redis, http.StatusInternalServerError, "redis error")
+	register(AWSS3, http.StatusInternalServerError, "aws s3 error")
+	register(Audit, http.StatusInternalServerError, "record audit event error")
+}
+
+// Register 註冊錯誤代碼，service package 應在 init 中註冊自己的錯誤代碼。
+// core 保留 1～2 位數、"1000"～"1999" 及 "9999"，service 請使用 5 位數以上的代碼，
+// 註冊保留的代碼或重複註冊相同代碼時會 panic
+//
+// example:
+//
+//	const OrderNotFound = "20001"
+//
+//	func init() {
+//		syserrno.Register(OrderNotFound, http.StatusNotFound, "order not found")
+//	}
+func Register(code string, httpStatus int, description string) {
+	if Reserved(code) {
+		panic(fmt.Sprintf("syserrno: code %s is reserved by core", code))
+	}
+	register(code, httpStatus, description)
+}
+
+// Reserved 是否為 core 保留的代碼
+func Reserved(code string) bool {
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return false
+	}
+	return len(code) <= 2 || (n >= 1000 && n <= 1999) || code == Undefined
+}
+
+func register(code string, httpStatus int, description string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exist := registry[code]; exist {
+		panic(fmt.Sprintf("syserrno: code %s is already registered", code))
+	}
+
+	registry[code] = Entry{
+		Code:        code,
+		HTTPStatus:  httpStatus,
+		Description: description,
+	}
+}
+
+// Lookup 取得已註冊的錯誤代碼
+func Lookup(code string) (e Entry, ok bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	e, ok = registry[code]
+	return
+}
+
+// Entries 回傳所有已註冊的錯誤代碼，依代碼排序
+func Entries() (res []Entry) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, e := range registry {
+		res = append(res, e)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if len(res[i].Code) != len(res[j].Code) {
+			return len(res[i].Code) < len(res[j].Code)
+		}
+		return res[i].Code < res[j].Code
+	})
+
+	return
+}
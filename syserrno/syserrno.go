@@ -1,5 +1,6 @@
 package syserrno
 
+// core 使用的錯誤代碼，保留的範圍參考 Register
 const (
 	OK = "0"
 	// 通用系統錯誤
@@ -7,11 +8,38 @@ const (
 
 	HTTP           = "10"
 	ValidParameter = "11"
+	Unauthorized   = "12"
 	RMQ            = "13"
+	// TooManyRequests middleware.RateLimit 超過限制
+	TooManyRequests = "14"
+	// Timeout middleware.Timeout 設定的期限已過
+	Timeout = "15"
+	// Conflict 請求與目前的狀態衝突
+	Conflict = "16"
+	// RequestTooLarge 請求 body 超過 middleware.BodyLimit 的限制
+	RequestTooLarge = "17"
+
+	// http/request 的子代碼
+	HTTPTimeout        = "1001"
+	HTTPRetryExhausted = "1002"
+	HTTPCircuitOpen    = "1003"
+
+	// 身分驗證的子代碼
+	InvalidSignature = "1201"
+	InvalidSysToken  = "1202"
+	InvalidToken     = "1203"
+	IPNotAllowed     = "1204"
+
+	// middleware.Idempotency 的子代碼
+	IdempotencyInProgress = "1601"
+	IdempotencyKeyReused  = "1602"
 
 	// storage
 	Mongo = "20"
 	MySQL = "21"
 	Redis = "22"
 	AWSS3 = "23"
+
+	// Audit audit 無法產生或保存稽核事件
+	Audit = "30"
 )